@@ -9,6 +9,7 @@
 package app
 
 import (
+    "errors"
     "fmt"
     "os"
     "strings"
@@ -45,6 +46,16 @@ type App interface {
 
     // Get non-flag arguments of the current command
     Arguments() []string
+
+    // Get configuration values
+    Configuration() Configuration
+}
+
+// Commands that load the configuration of another command, so that its flags
+// can be given, too. E.g. "fmd config advertise --interval 5".
+type configLoader interface {
+    // Get the name of the command whose configuration shall be loaded
+    ConfigCommand(arguments []string) string
 }
 
 type AppStruct struct {
@@ -59,16 +70,22 @@ type AppStruct struct {
 
     // Non-flag arguments of the currently running command
     arguments []string
+
+    // Configuration values
+    configuration Configuration
 }
 
-// Create new app instance
-func NewApp() App {
+// Create new app instance. config must be a pointer to the configuration
+// struct as described for the Configuration interface, or nil.
+func NewApp(config any) App {
     this := &AppStruct{
         commands: make(map[string]Command),
         arguments: make([]string, 0),
+        configuration: NewConfiguration(config),
     }
 
     this.AddCommand("help", NewHelpCommand())
+    this.AddCommand("config", NewConfigCommand())
     return this
 }
 
@@ -76,6 +93,7 @@ func (this *AppStruct) Commands() map[string]Command { return this.commands }
 func (this *AppStruct) Program() string { return this.program }
 func (this *AppStruct) Command() string { return this.command }
 func (this *AppStruct) Arguments() []string { return this.arguments }
+func (this *AppStruct) Configuration() Configuration { return this.configuration }
 
 // Register command with the app
 func (this *AppStruct) AddCommand(name string, command Command) {
@@ -124,10 +142,22 @@ func (this *AppStruct) Run(args []string) error {
 
     flags := args[flagIndex:]
 
-    // TODO: Read configuration values
-    fmt.Printf("Arguments: %v\n", this.arguments)
-    fmt.Printf("Flags: %v\n", flags)
-    fmt.Println()
+    // Read configuration values
+    configCommand := this.command
+
+    if loader, ok := command.(configLoader); ok {
+        configCommand = loader.ConfigCommand(this.arguments)
+    }
+
+    if err := this.configuration.Load(configCommand, flags); err != nil {
+        var unknownFlag *UnknownFlagError
+
+        if errors.As(err, &unknownFlag) {
+            return fmt.Errorf("%v\nSee '%v help %v' for a list of all flags", err, this.program, configCommand)
+        }
+
+        return err
+    }
 
     // Run the requested command
     return command.Run(this)
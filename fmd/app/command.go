@@ -9,12 +9,14 @@
 package app
 
 import (
+    "context"
     "fmt"
+    "log"
     "os"
     "os/signal"
     "syscall"
+    "time"
     "golang.org/x/sync/errgroup"
-    "github.com/DennisSchulmeister/find-my-device/fmd/str"
 )
 
 //------------------------------------------------------------------------------
@@ -32,8 +34,20 @@ type Command interface {
 }
 
 type CommandStruct struct {
-    Notify chan string
-    Steps  CommandSteps
+    Steps CommandSteps
+
+    // Maximum time to wait for the goroutines to return after the context
+    // has been cancelled. Usually points into the configuration, because it
+    // is only loaded after the command has been created. Default: 5 seconds.
+    StopTimeout *time.Duration
+
+    // Long-running commands can reload their configuration on SIGHUP.
+    // When values have changed, the go-routines are stopped and restarted
+    // with the new configuration.
+    Reloadable bool
+
+    // The go-routines are being stopped to reload the configuration
+    reloading bool
 }
 
 // Help texts for a command
@@ -50,21 +64,41 @@ type CommandHelp struct {
     Help string
 }
 
+// Startup banner of a command, printed before the command starts.
+// Only the title and the configuration values must be given, the
+// banner will be rendered from the help texts of the values.
+type CommandHeader struct {
+    // Title of the banner, e.g. "Advertise device information"
+    Title string
+
+    // Pointers to the configuration values to print, e.g. &config.General.Port
+    Values []any
+
+    // Don't print the banner at all
+    Quiet bool
+
+    // Print the banner as a single line of JSON, e.g. for log collectors
+    JSON bool
+}
+
 // Template methods for the default implementation of the Command Run() method.
 // The default implementation contains shared logic to validate configuration
 // and start one or more goroutines to perform the actual logic.
 //
-// The "Notify" channel in the CommandStruct is used for communication with the
-// goroutines. An interrupt signal (usually triggered by Ctrl+C) will cause the
-// string "quit" to be sent to the channel. Other than that, the channel has no
-// pre-defined use and can be freely used at will.
+// All goroutines receive a shared context, which is cancelled on an interrupt
+// signal (usually triggered by Ctrl+C), on SIGTERM or when the first goroutine
+// returns an error. The goroutines must then return as soon as possible. A
+// second interrupt signal terminates the program immediately.
+//
+// For reloadable commands the context is also cancelled, when the configuration
+// changes on SIGHUP. Validate() and Go() are then called again to restart the
+// go-routines with the new configuration.
 type CommandSteps interface {
     // Set app instance
     App(app App)
 
-    // Get header string with command description and configuration values
-    // TODO: Refactor so that the command must only tell, which configuration values to print
-    Header() string
+    // Get title and configuration values for the startup banner
+    Header() *CommandHeader
 
     // Perform sanity checks on the configuration values
     Validate() error
@@ -73,8 +107,15 @@ type CommandSteps interface {
     Go() []CommandFunc
 }
 
-// Go-routine with the actual command logic
-type CommandFunc func() error
+// Go-routine with the actual command logic. Must return when ctx is done.
+type CommandFunc func(ctx context.Context) error
+
+// Check in a go-routine, whether its context has been cancelled to reload
+// the configuration rather than to shut down. Only valid after the context
+// is done.
+func (this *CommandStruct) Reloading() bool {
+    return this.reloading
+}
 
 // Default implementation of the Help() method
 func (this *CommandStruct) Help() *CommandHelp {
@@ -86,33 +127,128 @@ func (this *CommandStruct) Help() *CommandHelp {
 // actual command logic.
 func (this *CommandStruct) Run(app App) error {
     if this.Steps == nil { panic("The default Run() method needs this.Steps") }
-
-    // Print configuration values
-    header := str.FixMultiLineString(this.Steps.Header()) + "\n"
-    fmt.Printf(header)
+    this.Steps.App(app)
 
     // Check configuration values
     if err := this.Steps.Validate(); err != nil {
         return err
     }
 
-    // Handle interrupt signals caused by Ctrl+C
-    this.Notify = make(chan string)
+    // Print configuration values
+    if err := printHeader(app, this.Steps.Header()); err != nil {
+        return err
+    }
 
-    signals := make(chan os.Signal)
-    signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+    // Cancel context on interrupt signals caused by Ctrl+C
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
 
     go func() {
-        <- signals
-        this.Notify <- "quit"
+        // Restore default behaviour, so that a second Ctrl+C terminates the program
+        <- ctx.Done()
+        stop()
     }()
 
-    // Execute go-routines
-    waitgroup := new(errgroup.Group)
+    // Reload configuration on SIGHUP
+    reload := make(chan os.Signal, 1)
+
+    if this.Reloadable {
+        signal.Notify(reload, syscall.SIGHUP)
+        defer signal.Stop(reload)
+    }
+
+    for {
+        restart, err := this.runGoroutines(app, ctx, reload)
+        if !restart { return err }
+    }
+}
+
+// Execute the go-routines until they return, the context is done or the
+// configuration has changed. In the latter case restart will be true.
+func (this *CommandStruct) runGoroutines(app App, ctx context.Context, reload chan os.Signal) (restart bool, err error) {
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+
+    this.reloading = false
+    waitgroup, ctx := errgroup.WithContext(ctx)
 
     for _, goroutine := range this.Steps.Go() {
-        waitgroup.Go(goroutine)
+        goroutine := goroutine
+        waitgroup.Go(func() error { return goroutine(ctx) })
     }
 
-    return waitgroup.Wait()
+    done := make(chan error, 1)
+    go func() { done <- waitgroup.Wait() }()
+
+    for {
+        select {
+            case err := <- done:
+                return false, err
+            case <- ctx.Done():
+                return false, this.waitForShutdown(done)
+            case <- reload:
+        }
+
+        // Read configuration again and restart go-routines if changed
+        changes, err := app.Configuration().Reload()
+
+        if err != nil {
+            log.Printf("Cannot reload configuration: %v", err)
+            continue
+        } else if len(changes) == 0 {
+            log.Printf("Configuration reloaded without changes")
+            continue
+        }
+
+        // Validate the new values before disturbing the running go-routines.
+        // The changes are reverted until the go-routines have stopped, as
+        // they still read the configuration.
+        for _, change := range changes {
+            change.Apply()
+        }
+
+        err = this.Steps.Validate()
+
+        for _, change := range changes {
+            change.Revert()
+        }
+
+        if err != nil {
+            log.Printf("Keeping previous configuration: %v", err)
+            continue
+        }
+
+        for _, change := range changes {
+            log.Printf("Configuration changed: %v", change)
+        }
+
+        this.reloading = true
+        cancel()
+
+        if err := this.waitForShutdown(done); err != nil {
+            return false, err
+        }
+
+        for _, change := range changes {
+            change.Apply()
+        }
+
+        return true, nil
+    }
+}
+
+// Wait for the go-routines to return after the context has been cancelled
+func (this *CommandStruct) waitForShutdown(done chan error) error {
+    timeout := 5 * time.Second
+
+    if this.StopTimeout != nil {
+        timeout = *this.StopTimeout
+    }
+
+    select {
+        case err := <- done:
+            return err
+        case <- time.After(timeout):
+            return fmt.Errorf("Command did not shut down within %v", timeout)
+    }
 }
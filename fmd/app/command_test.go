@@ -0,0 +1,147 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+package app
+
+import (
+    "context"
+    "errors"
+    "os"
+    "strings"
+    "syscall"
+    "testing"
+    "time"
+)
+
+type testCommandStruct struct {
+    CommandStruct
+    functions []CommandFunc
+    validate  func() error
+}
+
+func newTestCommand(functions ...CommandFunc) *testCommandStruct {
+    this := &testCommandStruct{functions: functions}
+    this.CommandStruct.Steps = this
+    return this
+}
+
+func (this *testCommandStruct) App(app App)            {}
+func (this *testCommandStruct) Header() *CommandHeader { return nil }
+func (this *testCommandStruct) Validate() error {
+    if this.validate == nil { return nil }
+    return this.validate()
+}
+
+func (this *testCommandStruct) Go() []CommandFunc      { return this.functions }
+
+func Test_CommandCancelsSiblings(t *testing.T) {
+    failure := errors.New("failure")
+    stopped := make(chan bool, 1)
+
+    command := newTestCommand(
+        func(ctx context.Context) error {
+            <- ctx.Done()
+            stopped <- true
+            return nil
+        },
+        func(ctx context.Context) error {
+            return failure
+        },
+    )
+
+    if err := command.Run(NewApp(nil)); err != failure {
+        t.Errorf("Run() returned %v instead of %v", err, failure)
+    }
+
+    select {
+        case <- stopped:
+        default:
+            t.Errorf("Sibling goroutine was not cancelled")
+    }
+}
+
+func Test_CommandStopTimeout(t *testing.T) {
+    timeout := 10 * time.Millisecond
+
+    command := newTestCommand(
+        func(ctx context.Context) error {
+            time.Sleep(time.Second)
+            return nil
+        },
+        func(ctx context.Context) error {
+            return errors.New("failure")
+        },
+    )
+
+    command.StopTimeout = &timeout
+
+    if err := command.Run(NewApp(nil)); err == nil || !strings.Contains(err.Error(), "did not shut down") {
+        t.Errorf("Run() didn't time out: %v", err)
+    }
+}
+
+func Test_CommandReloadInvalidConfiguration(t *testing.T) {
+    t.Setenv("TEST_RUN_INTERVAL", "10")
+
+    config := &testConfig{}
+    app    := NewApp(config)
+
+    if err := app.Configuration().Load("run", []string{}); err != nil {
+        t.Fatalf("Load() returned %v", err)
+    }
+
+    started := make(chan bool, 2)
+    stopped := make(chan bool, 2)
+
+    command := newTestCommand(func(ctx context.Context) error {
+        started <- true
+        <- ctx.Done()
+        stopped <- true
+        return nil
+    })
+
+    command.validate = func() error {
+        if config.Run.Interval <= 0 { return errors.New("Interval must be positive") }
+        return nil
+    }
+
+    ctx, cancel := context.WithCancel(context.Background())
+    reload := make(chan os.Signal, 1)
+    result := make(chan bool, 1)
+
+    go func() {
+        restart, _ := command.runGoroutines(app, ctx, reload)
+        result <- restart
+    }()
+
+    <- started
+    t.Setenv("TEST_RUN_INTERVAL", "0")
+    reload <- syscall.SIGHUP
+
+    select {
+        case <- stopped:
+            t.Errorf("Go-routines were stopped by an invalid configuration")
+        case restart := <- result:
+            t.Fatalf("runGoroutines() returned with restart = %v", restart)
+        case <- time.After(100 * time.Millisecond):
+    }
+
+    cancel()
+
+    if restart := <- result; restart {
+        t.Errorf("runGoroutines() requested a restart after an invalid configuration")
+    }
+
+    if config.Run.Interval != 10 * time.Second {
+        t.Errorf("Invalid configuration was not reverted: %v", config.Run.Interval)
+    }
+
+    if len(started) != 0 {
+        t.Errorf("Go-routines were restarted")
+    }
+}
@@ -7,3 +7,579 @@
 // License, or (at your option) any later version.
 
 package app
+
+import (
+    "errors"
+    "fmt"
+    "io/fs"
+    "os"
+    "reflect"
+    "strconv"
+    "strings"
+    "time"
+    "github.com/DennisSchulmeister/find-my-device/fmd/str"
+)
+
+// Layered configuration of the app. The configuration is a struct whose fields
+// are sections (again structs) with the actual configuration values. The
+// sections are tagged with the prefix of their environment variables and the
+// name of the command they belong to, e.g.:
+//
+//      type Config struct {
+//          General   GeneralConfig   `prefix:"FMD_"           command:""`
+//          Advertise AdvertiseConfig `prefix:"FMD_ADVERTISE_" command:"advertise"`
+//      }
+//
+// The values inside the sections are tagged with their default value, whether
+// they must be hidden from the user (e.g. passwords) and a short help text:
+//
+//      type AdvertiseConfig struct {
+//          Interval time.Duration `default:"15" hide:"false" help:"Seconds between advertisements"`
+//      }
+//
+// Values are loaded in the following order, each layer overwriting the values
+// of the previous layers: Default values, config files, environment variables,
+// command line flags.
+type Configuration interface {
+    // Get all configuration values in declaration order
+    Values() []*ConfigValue
+
+    // Get the general values and the values of the given command
+    ValuesFor(command string) []*ConfigValue
+
+    // Find the configuration value of a struct field, e.g. &config.General.Port.
+    // Returns nil, if the pointer doesn't point to a configuration value.
+    Lookup(pointer any) *ConfigValue
+
+    // Add config file to be read when loading the configuration. All files
+    // are read in the order they were added, missing files are ignored.
+    // The files can be replaced with the --config flag or CONFIG env variable
+    // (with prefix of the general section), e.g. FMD_CONFIG.
+    AddFile(path string)
+
+    // Load all configuration values. flags are the command line flags of
+    // the given command, e.g. ["--interval", "10", "--respond=false"].
+    // Hidden values like passwords can be given as flags without value to
+    // let the user enter them on the console.
+    Load(command string, flags []string) error
+
+    // Read config files, env variables and flags again, e.g. on SIGHUP.
+    // Returns the changed general values and values of the loaded command
+    // without applying them. Values entered interactively are kept.
+    Reload() ([]*ConfigChange, error)
+
+    // Make sure, that the given values are not empty, e.g.
+    // Require(true, &config.General.Username, &config.General.Password).
+    // If interactive is true and the standard input is a terminal, the user
+    // is asked to enter missing values. Otherwise an error is returned.
+    Require(interactive bool, pointers ...any) error
+
+    // Allow or forbid asking the user for values. When forbidden, Require()
+    // returns an error for missing values regardless of its interactive
+    // parameter, e.g. while only validating the configuration.
+    SetInteractive(interactive bool)
+}
+
+type ConfigurationStruct struct {
+    // All configuration values in declaration order
+    values []*ConfigValue
+
+    // Config files to read, unless overwritten by flag or env variable
+    files []string
+
+    // Env variable to overwrite the config files
+    filesEnv string
+
+    // Type of the configuration struct, nil without configuration
+    configType reflect.Type
+
+    // Command and flags of the last Load() for Reload()
+    command string
+    flags   []string
+
+    // Don't ask the user for any values, e.g. for hidden values given as
+    // flags without value
+    noPrompt bool
+}
+
+// Metadata and current value of a single configuration value
+type ConfigValue struct {
+    // Lower-case name of the section, e.g. "advertise"
+    Section string
+
+    // Command the value belongs to, empty for general values
+    Command string
+
+    // Name of the struct field, e.g. "DeviceName"
+    Name string
+
+    // Name of the command line flag without dashes, e.g. "device-name"
+    Flag string
+
+    // Name of the environment variable, e.g. "FMD_ADVERTISE_DEVICE_NAME"
+    Env string
+
+    // Key in the config file, e.g. "advertise.device_name"
+    Key string
+
+    // Default value as written in the struct tag
+    Default string
+
+    // Value must not be shown to the user
+    Hide bool
+
+    // Short help text
+    Help string
+
+    // Layer from which the current value has been read
+    Source ConfigSource
+
+    // Exact origin of the current value, e.g. file name and line, env
+    // variable or flag name. Empty for default values.
+    Origin string
+
+    // Addressable struct field holding the current value
+    Value reflect.Value
+}
+
+// Changed configuration value after reloading the configuration
+type ConfigChange struct {
+    Value *ConfigValue
+
+    oldValue  reflect.Value
+    oldSource ConfigSource
+    oldOrigin string
+
+    newValue  reflect.Value
+    newSource ConfigSource
+    newOrigin string
+}
+
+// Layer from which a configuration value has been read
+type ConfigSource string
+
+const (
+    SourceDefault ConfigSource = "default"
+    SourceFile    ConfigSource = "file"
+    SourceEnv     ConfigSource = "env"
+    SourceFlag    ConfigSource = "flag"
+    SourcePrompt  ConfigSource = "prompt"
+)
+
+// Error for command line flags not known to the current command
+type UnknownFlagError struct {
+    Flag    string
+    Command string
+}
+
+func (this *UnknownFlagError) Error() string {
+    return fmt.Sprintf("Unknown flag for command '%v': --%v", this.Command, this.Flag)
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Create new configuration for the given pointer to a configuration struct.
+// config may be nil, if the app has no configuration values.
+func NewConfiguration(config any) Configuration {
+    this := &ConfigurationStruct{
+        values: make([]*ConfigValue, 0),
+        files:  make([]string, 0),
+    }
+
+    if config == nil {
+        return this
+    }
+
+    configValue := reflect.ValueOf(config)
+
+    if configValue.Kind() != reflect.Pointer || configValue.Elem().Kind() != reflect.Struct {
+        panic(fmt.Sprintf("Configuration must be a pointer to a struct, not %T", config))
+    }
+
+    configValue = configValue.Elem()
+    configType := configValue.Type()
+    this.configType = configType
+
+    for i := 0; i < configType.NumField(); i++ {
+        sectionField := configType.Field(i)
+        sectionValue := configValue.Field(i)
+
+        if sectionField.Type.Kind() != reflect.Struct {
+            panic(fmt.Sprintf("Configuration section %v must be a struct", sectionField.Name))
+        }
+
+        section := strings.ToLower(sectionField.Name)
+        prefix  := sectionField.Tag.Get("prefix")
+        command := sectionField.Tag.Get("command")
+
+        if command == "" {
+            this.filesEnv = prefix + "CONFIG"
+        }
+
+        for j := 0; j < sectionField.Type.NumField(); j++ {
+            field := sectionField.Type.Field(j)
+            words := str.SplitCamelCaseString(field.Name)
+
+            value := &ConfigValue{
+                Section: section,
+                Command: command,
+                Name:    field.Name,
+                Flag:    strings.ToLower(strings.Join(words, "-")),
+                Env:     prefix + strings.ToUpper(strings.Join(words, "_")),
+                Key:     section + "." + strings.ToLower(strings.Join(words, "_")),
+                Default: field.Tag.Get("default"),
+                Hide:    field.Tag.Get("hide") == "true",
+                Help:    field.Tag.Get("help"),
+                Source:  SourceDefault,
+                Value:   sectionValue.Field(j),
+            }
+
+            this.values = append(this.values, value)
+        }
+    }
+
+    return this
+}
+
+// Add config file to be read when loading the configuration
+func (this *ConfigurationStruct) AddFile(path string) {
+    this.files = append(this.files, path)
+}
+
+// Get all configuration values in declaration order
+func (this *ConfigurationStruct) Values() []*ConfigValue {
+    return this.values
+}
+
+// Get the general values and the values of the given command
+func (this *ConfigurationStruct) ValuesFor(command string) []*ConfigValue {
+    result := make([]*ConfigValue, 0)
+
+    for _, value := range this.values {
+        if value.Command == "" || value.Command == command {
+            result = append(result, value)
+        }
+    }
+
+    return result
+}
+
+// Find the configuration value of a struct field
+func (this *ConfigurationStruct) Lookup(pointer any) *ConfigValue {
+    for _, value := range this.values {
+        if value.Value.Addr().Interface() == pointer {
+            return value
+        }
+    }
+
+    return nil
+}
+
+// Load all configuration values. Flags can be given as "--flag value" or
+// "--flag=value". The value can be omitted for boolean flags, meaning "true".
+func (this *ConfigurationStruct) Load(command string, flags []string) error {
+    this.command = command
+    this.flags   = flags
+
+    for _, value := range this.values {
+        if err := value.Set(value.Default, SourceDefault); err != nil {
+            panic(fmt.Sprintf("Invalid default value for %v: %v", value.Key, err))
+        }
+    }
+
+    if err := this.readFiles(flags); err != nil {
+        return err
+    }
+
+    for _, value := range this.values {
+        text, found := os.LookupEnv(value.Env)
+        if !found { continue }
+
+        if err := value.Set(text, SourceEnv); err != nil {
+            return fmt.Errorf("Environment variable %v: %v", value.Env, err)
+        }
+
+        value.Origin = value.Env
+    }
+
+    return this.parseFlags(command, flags)
+}
+
+// Parse command line flags. Only general flags and the flags of the given
+// command are allowed.
+func (this *ConfigurationStruct) parseFlags(command string, flags []string) error {
+    values := make(map[string]*ConfigValue)
+
+    for _, value := range this.ValuesFor(command) {
+        if other, found := values[value.Flag]; found {
+            panic(fmt.Sprintf("Flag --%v of %v conflicts with %v", value.Flag, value.Key, other.Key))
+        }
+
+        values[value.Flag] = value
+    }
+
+    for i := 0; i < len(flags); i++ {
+        flag := flags[i]
+
+        if configFlag(flag) {
+            if !strings.Contains(flag, "=") { i++ }
+            continue
+        }
+
+        if !strings.HasPrefix(flag, "-") {
+            return fmt.Errorf("Unexpected argument '%v' between the flags", flag)
+        }
+
+        name, text, hasText := strings.Cut(strings.TrimLeft(flag, "-"), "=")
+        value, found := values[name]
+
+        if !found {
+            return &UnknownFlagError{Flag: name, Command: command}
+        }
+
+        if !hasText {
+            if value.Value.Kind() == reflect.Bool {
+                text = "true"
+            } else if i + 1 < len(flags) && !strings.HasPrefix(flags[i + 1], "-") {
+                i++
+                text = flags[i]
+            } else if value.Hide && this.noPrompt {
+                continue
+            } else if value.Hide && canPrompt() {
+                if err := promptValue(value); err != nil { return err }
+                continue
+            } else {
+                return fmt.Errorf("Flag --%v requires a value", name)
+            }
+        }
+
+        if err := value.Set(text, SourceFlag); err != nil {
+            return fmt.Errorf("Flag --%v: %v", name, err)
+        }
+
+        value.Origin = "--" + name
+    }
+
+    return nil
+}
+
+// Read config files, env variables and flags again. Changes of other commands
+// are ignored, as they don't affect the running command.
+func (this *ConfigurationStruct) Reload() ([]*ConfigChange, error) {
+    changes := make([]*ConfigChange, 0)
+
+    if this.configType == nil {
+        return changes, nil
+    }
+
+    shadow := NewConfiguration(reflect.New(this.configType).Interface()).(*ConfigurationStruct)
+    shadow.files    = this.files
+    shadow.noPrompt = true
+
+    if err := shadow.Load(this.command, this.flags); err != nil {
+        return nil, err
+    }
+
+    for i, value := range this.values {
+        other := shadow.values[i]
+
+        if value.Command != "" && value.Command != this.command {
+            continue
+        }
+
+        if value.Source == SourcePrompt || reflect.DeepEqual(value.Value.Interface(), other.Value.Interface()) {
+            continue
+        }
+
+        changes = append(changes, &ConfigChange{
+            Value:     value,
+            oldValue:  reflect.ValueOf(value.Value.Interface()),
+            oldSource: value.Source,
+            oldOrigin: value.Origin,
+            newValue:  other.Value,
+            newSource: other.Source,
+            newOrigin: other.Origin,
+        })
+    }
+
+    return changes, nil
+}
+
+// Allow or forbid asking the user for values
+func (this *ConfigurationStruct) SetInteractive(interactive bool) {
+    this.noPrompt = !interactive
+}
+
+// Make sure, that the given values are not empty
+func (this *ConfigurationStruct) Require(interactive bool, pointers ...any) error {
+    missing := make([]string, 0)
+
+    for _, pointer := range pointers {
+        value := this.Lookup(pointer)
+
+        if value == nil {
+            panic(fmt.Sprintf("Pointer %v is not a configuration value", pointer))
+        }
+
+        if !value.Value.IsZero() {
+            continue
+        }
+
+        if interactive && !this.noPrompt && canPrompt() {
+            if err := promptValue(value); err != nil { return err }
+            if !value.Value.IsZero() { continue }
+        }
+
+        missing = append(missing, missingValueError(value))
+    }
+
+    if len(missing) > 0 {
+        return errors.New(strings.Join(missing, "\n"))
+    }
+
+    return nil
+}
+
+// Read the config files given by --config flag, env variable or AddFile()
+func (this *ConfigurationStruct) readFiles(flags []string) error {
+    file := ""
+
+    for i, flag := range flags {
+        if !configFlag(flag) { continue }
+
+        if _, text, found := strings.Cut(flag, "="); found {
+            file = text
+        } else if i + 1 < len(flags) {
+            file = flags[i + 1]
+        } else {
+            return fmt.Errorf("Flag --config requires a value")
+        }
+    }
+
+    if file == "" && this.filesEnv != "" {
+        file = os.Getenv(this.filesEnv)
+    }
+
+    if file != "" {
+        return this.readFile(file)
+    }
+
+    for _, file := range this.files {
+        if err := this.readFile(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+            return err
+        }
+    }
+
+    return nil
+}
+
+// Check whether the command line flag is the --config flag
+func configFlag(flag string) bool {
+    name, _, _ := strings.Cut(strings.TrimLeft(flag, "-"), "=")
+    return strings.HasPrefix(flag, "-") && name == "config"
+}
+
+// Parse the given text and set it as the new value. Empty text sets the zero
+// value. Durations can be given in seconds or with a unit, e.g. "1m30s".
+// The origin of the value is reset and must be set by the caller.
+func (this *ConfigValue) Set(text string, source ConfigSource) error {
+    text = strings.TrimSpace(text)
+    value := this.Value
+
+    if text == "" {
+        value.Set(reflect.Zero(value.Type()))
+        this.Source = source
+        this.Origin = ""
+        return nil
+    }
+
+    switch {
+        case value.Type() == durationType:
+            duration, err := parseDuration(text)
+            if err != nil { return err }
+            value.SetInt(int64(duration))
+
+        case value.Kind() == reflect.String:
+            value.SetString(text)
+
+        case value.Kind() == reflect.Bool:
+            boolean, err := strconv.ParseBool(text)
+            if err != nil { return fmt.Errorf("Invalid boolean value '%v'", text) }
+            value.SetBool(boolean)
+
+        case value.CanInt():
+            number, err := strconv.ParseInt(text, 10, value.Type().Bits())
+            if err != nil { return fmt.Errorf("Invalid number '%v'", text) }
+            value.SetInt(number)
+
+        case value.CanUint():
+            number, err := strconv.ParseUint(text, 10, value.Type().Bits())
+            if err != nil { return fmt.Errorf("Invalid positive number '%v'", text) }
+            value.SetUint(number)
+
+        default:
+            panic(fmt.Sprintf("Unsupported type %v of configuration value %v", value.Type(), this.Key))
+    }
+
+    this.Source = source
+    this.Origin = ""
+    return nil
+}
+
+// Get the current value as text, in the same format accepted by Set()
+func (this *ConfigValue) String() string {
+    if this.Value.Type() == durationType {
+        return time.Duration(this.Value.Int()).String()
+    }
+
+    return fmt.Sprint(this.Value.Interface())
+}
+
+// Set the changed value
+func (this *ConfigChange) Apply() {
+    this.Value.Value.Set(this.newValue)
+    this.Value.Source = this.newSource
+    this.Value.Origin = this.newOrigin
+}
+
+// Restore the previous value
+func (this *ConfigChange) Revert() {
+    this.Value.Value.Set(this.oldValue)
+    this.Value.Source = this.oldSource
+    this.Value.Origin = this.oldOrigin
+}
+
+// Describe the change, e.g. "advertise.interval: "15s" -> "30s""
+func (this *ConfigChange) String() string {
+    if this.Value.Hide {
+        return fmt.Sprintf("%v: hidden value changed", this.Value.Key)
+    }
+
+    oldValue := *this.Value
+    oldValue.Value = this.oldValue
+
+    newValue := *this.Value
+    newValue.Value = this.newValue
+
+    return fmt.Sprintf("%v: %v -> %v", this.Value.Key, formatValue(&oldValue), formatValue(&newValue))
+}
+
+// Get the current value for display to the user. Hidden values are masked.
+func (this *ConfigValue) Display() string {
+    if this.Hide && !this.Value.IsZero() {
+        return "********"
+    }
+
+    return this.String()
+}
+
+// Parse duration, either given as a plain number of seconds or with unit
+func parseDuration(text string) (time.Duration, error) {
+    if seconds, err := strconv.ParseFloat(text, 64); err == nil {
+        return time.Duration(seconds * float64(time.Second)), nil
+    }
+
+    duration, err := time.ParseDuration(text)
+    if err != nil { return 0, fmt.Errorf("Invalid duration '%v'", text) }
+    return duration, nil
+}
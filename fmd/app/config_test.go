@@ -0,0 +1,220 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+package app
+
+import (
+    "testing"
+    "time"
+)
+
+type testConfig struct {
+    General testGeneralConfig `prefix:"TEST_"      command:""`
+    Run     testRunConfig     `prefix:"TEST_RUN_"  command:"run"`
+}
+
+type testGeneralConfig struct {
+    MulticastIP4 string        `default:"224.0.0.1"  hide:"false"  help:"Multicast address"`
+    Port         uint32        `default:"54321"      hide:"false"  help:"Port"`
+    Password     string        `default:""           hide:"true"   help:"Password"`
+}
+
+type testRunConfig struct {
+    Interval     time.Duration `default:"15"         hide:"false"  help:"Interval"`
+    DeviceName   string        `default:"device"     hide:"false"  help:"Device name"`
+    Verbose      bool          `default:"false"      hide:"false"  help:"Verbose"`
+}
+
+func Test_ConfigurationNames(t *testing.T) {
+    config := &testConfig{}
+    value  := NewConfiguration(config).Lookup(&config.Run.DeviceName)
+
+    if value == nil {
+        t.Fatalf("Lookup() didn't find the configuration value")
+    }
+
+    if value.Flag != "device-name" {
+        t.Errorf("Flag is %v instead of device-name", value.Flag)
+    }
+
+    if value.Env != "TEST_RUN_DEVICE_NAME" {
+        t.Errorf("Env is %v instead of TEST_RUN_DEVICE_NAME", value.Env)
+    }
+
+    if value.Key != "run.device_name" {
+        t.Errorf("Key is %v instead of run.device_name", value.Key)
+    }
+
+    value = NewConfiguration(config).Lookup(&config.General.MulticastIP4)
+
+    if value.Flag != "multicast-ip4" {
+        t.Errorf("Flag is %v instead of multicast-ip4", value.Flag)
+    }
+}
+
+func Test_ConfigurationLoad(t *testing.T) {
+    t.Setenv("TEST_PORT", "1234")
+    t.Setenv("TEST_RUN_INTERVAL", "1m")
+
+    config := &testConfig{}
+    configuration := NewConfiguration(config)
+
+    if err := configuration.Load("run", []string{}); err != nil {
+        t.Fatalf("Load() returned %v", err)
+    }
+
+    if config.General.MulticastIP4 != "224.0.0.1" {
+        t.Errorf("Default value not set: %v", config.General.MulticastIP4)
+    }
+
+    if config.General.Port != 1234 {
+        t.Errorf("Env variable not read: %v", config.General.Port)
+    }
+
+    if config.Run.Interval != time.Minute {
+        t.Errorf("Duration with unit not parsed: %v", config.Run.Interval)
+    }
+
+    if source := configuration.Lookup(&config.General.Port).Source; source != SourceEnv {
+        t.Errorf("Source is %v instead of %v", source, SourceEnv)
+    }
+
+    t.Setenv("TEST_RUN_INTERVAL", "abc")
+
+    if err := configuration.Load("run", []string{}); err == nil {
+        t.Errorf("Load() accepted an invalid duration")
+    }
+}
+
+func Test_ConfigValueSet(t *testing.T) {
+    config := &testConfig{}
+    configuration := NewConfiguration(config)
+
+    tests := make(map[string]time.Duration)
+    tests["15"]    = 15 * time.Second
+    tests["0.5"]   = 500 * time.Millisecond
+    tests["1m30s"] = 90 * time.Second
+    tests[""]      = 0
+
+    for text, expected := range tests {
+        configuration.Lookup(&config.Run.Interval).Set(text, SourceFlag)
+
+        if config.Run.Interval != expected {
+            t.Errorf("Set(%v) resulted in %v instead of %v", text, config.Run.Interval, expected)
+        }
+    }
+
+    if err := configuration.Lookup(&config.General.Port).Set("-1", SourceFlag); err == nil {
+        t.Errorf("Set() accepted a negative port number")
+    }
+
+    if err := configuration.Lookup(&config.Run.Verbose).Set("maybe", SourceFlag); err == nil {
+        t.Errorf("Set() accepted an invalid boolean value")
+    }
+}
+
+func Test_ConfigurationFlags(t *testing.T) {
+    t.Setenv("TEST_RUN_DEVICE_NAME", "from-env")
+
+    config := &testConfig{}
+    configuration := NewConfiguration(config)
+
+    flags := []string{"--device-name", "from-flag", "--port=1000", "--verbose"}
+
+    if err := configuration.Load("run", flags); err != nil {
+        t.Fatalf("Load() returned %v", err)
+    }
+
+    if config.Run.DeviceName != "from-flag" {
+        t.Errorf("Flag didn't overwrite env variable: %v", config.Run.DeviceName)
+    }
+
+    if config.General.Port != 1000 || !config.Run.Verbose {
+        t.Errorf("Flags not parsed: %v, %v", config.General.Port, config.Run.Verbose)
+    }
+
+    err := configuration.Load("other", []string{"--verbose"})
+
+    if _, ok := err.(*UnknownFlagError); !ok {
+        t.Errorf("Flag of another command was accepted: %v", err)
+    }
+
+    if err := configuration.Load("run", []string{"--device-name"}); err == nil {
+        t.Errorf("Flag without value was accepted")
+    }
+}
+
+func Test_ConfigurationReload(t *testing.T) {
+    t.Setenv("TEST_RUN_INTERVAL", "10")
+
+    config := &testConfig{}
+    configuration := NewConfiguration(config)
+
+    if err := configuration.Load("run", []string{"--port", "1000"}); err != nil {
+        t.Fatalf("Load() returned %v", err)
+    }
+
+    t.Setenv("TEST_RUN_INTERVAL", "20")
+    t.Setenv("TEST_PASSWORD", "secret")
+
+    changes, err := configuration.Reload()
+
+    if err != nil {
+        t.Fatalf("Reload() returned %v", err)
+    }
+
+    if len(changes) != 2 || config.Run.Interval != 10 * time.Second {
+        t.Fatalf("Reload() returned %v changes and applied them", len(changes))
+    }
+
+    if description := changes[0].String(); description != "general.password: hidden value changed" {
+        t.Errorf("Wrong description of hidden value: %v", description)
+    }
+
+    if description := changes[1].String(); description != `run.interval: "10s" -> "20s"` {
+        t.Errorf("Wrong description of changed value: %v", description)
+    }
+
+    for _, change := range changes {
+        change.Apply()
+    }
+
+    if config.Run.Interval != 20 * time.Second || config.General.Port != 1000 {
+        t.Errorf("Changes not applied: %v, %v", config.Run.Interval, config.General.Port)
+    }
+
+    changes[1].Revert()
+
+    if config.Run.Interval != 10 * time.Second {
+        t.Errorf("Change not reverted: %v", config.Run.Interval)
+    }
+}
+
+func Test_ConfigurationReloadOtherCommand(t *testing.T) {
+    t.Setenv("TEST_RUN_INTERVAL", "10")
+
+    config := &testConfig{}
+    configuration := NewConfiguration(config)
+
+    if err := configuration.Load("other", []string{}); err != nil {
+        t.Fatalf("Load() returned %v", err)
+    }
+
+    t.Setenv("TEST_RUN_INTERVAL", "20")
+    t.Setenv("TEST_PORT", "1000")
+
+    changes, err := configuration.Reload()
+
+    if err != nil {
+        t.Fatalf("Reload() returned %v", err)
+    }
+
+    if len(changes) != 1 || changes[0].Value.Key != "general.port" {
+        t.Errorf("Reload() returned changes of another command: %v", changes)
+    }
+}
@@ -0,0 +1,172 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+package app
+
+import (
+    "fmt"
+    "reflect"
+    "sort"
+    "strconv"
+    "strings"
+    "golang.org/x/exp/maps"
+    "github.com/DennisSchulmeister/find-my-device/fmd/str"
+)
+
+// Build in config command. Either prints the fully resolved configuration
+// with the origin of each value or validates the configuration of all
+// commands. If a command name is given, only the general values and the
+// values of that command are printed, and the command's flags can be used.
+type ConfigCommandStruct struct {
+    CommandStruct
+    app App
+}
+
+// Commands whose configuration can be validated without running them
+type validator interface {
+    App(app App)
+    Validate() error
+}
+
+// Create new config command instance
+func NewConfigCommand() Command {
+    return &ConfigCommandStruct{}
+}
+
+// Provide help information
+func (this *ConfigCommandStruct) Help() *CommandHelp {
+    return &CommandHelp{
+        Description: "Show or validate the configuration",
+        Arguments: "[<command> | validate]",
+        Help: `
+            Without arguments all configuration values are printed after reading
+            the config files, environment variables and flags. Each value is
+            annotated with where it came from. The output can be used as a config
+            file, though hidden values like passwords are masked.
+
+            With a command name only the general values and the values of that
+            command are printed. The command's flags can then be given, too:
+
+                $program$ $command$ advertise --interval 5
+
+            With '$program$ $command$ validate' the configuration of all commands
+            is checked without actually running them.
+        `,
+    }
+}
+
+// Load the configuration of the command given as argument, if any
+func (this *ConfigCommandStruct) ConfigCommand(arguments []string) string {
+    if len(arguments) > 0 && arguments[0] != "validate" {
+        return arguments[0]
+    }
+
+    return "config"
+}
+
+// Run the command
+func (this *ConfigCommandStruct) Run(app App) error {
+    this.app = app
+    arguments := app.Arguments()
+
+    if len(arguments) > 1 {
+        return fmt.Errorf("Too many arguments. See '%v help %v' for usage", app.Program(), app.Command())
+    }
+
+    if len(arguments) == 0 {
+        fmt.Print(renderConfiguration(app.Configuration().Values()))
+        return nil
+    } else if arguments[0] == "validate" {
+        return this.validateConfiguration()
+    } else if _, found := app.Commands()[arguments[0]]; found {
+        fmt.Print(renderConfiguration(app.Configuration().ValuesFor(arguments[0])))
+        return nil
+    } else {
+        return fmt.Errorf("Unknown argument '%v'. See '%v help %v' for usage", arguments[0], app.Program(), app.Command())
+    }
+}
+
+// Render values in config file format, annotated with their origin
+func renderConfiguration(values []*ConfigValue) string {
+    sections := make([]string, 0)
+    tables   := make(map[string]*str.Table)
+
+    for _, value := range values {
+        table, found := tables[value.Section]
+
+        if !found {
+            table = str.NewTable()
+            tables[value.Section] = table
+            sections = append(sections, value.Section)
+        }
+
+        _, key, _ := strings.Cut(value.Key, ".")
+        origin := string(value.Source)
+
+        if value.Origin != "" {
+            origin = fmt.Sprintf("%v %v", value.Source, value.Origin)
+        }
+
+        table.AddRow(fmt.Sprintf("%v = %v", key, formatValue(value)), "# " + origin)
+    }
+
+    builder := strings.Builder{}
+    builder.WriteString("# Configuration after reading all config files, env variables and flags\n")
+
+    for _, section := range sections {
+        builder.WriteString(fmt.Sprintf("\n[%v]\n", section))
+        builder.WriteString(tables[section].String())
+    }
+
+    return builder.String()
+}
+
+// Run the Validate() method of all commands without asking the user for
+// missing values
+func (this *ConfigCommandStruct) validateConfiguration() error {
+    // Report missing values instead of asking for them
+    this.app.Configuration().SetInteractive(false)
+    defer this.app.Configuration().SetInteractive(true)
+
+    names := maps.Keys(this.app.Commands())
+    sort.Strings(names)
+
+    table  := str.NewTable()
+    failed := 0
+
+    for _, name := range names {
+        command, ok := this.app.Commands()[name].(validator)
+        if !ok { continue }
+
+        command.App(this.app)
+
+        if err := command.Validate(); err != nil {
+            table.AddRow(name + ":", strings.ReplaceAll(err.Error(), "\n", "; "))
+            failed++
+        } else {
+            table.AddRow(name + ":", "OK")
+        }
+    }
+
+    fmt.Print(table.String())
+
+    if failed > 0 {
+        return fmt.Errorf("Configuration of %v command(s) is invalid", failed)
+    }
+
+    return nil
+}
+
+// Format value as TOML value with hidden values masked
+func formatValue(value *ConfigValue) string {
+    if value.Hide || value.Value.Type() == durationType || value.Value.Kind() == reflect.String {
+        return strconv.Quote(value.Display())
+    }
+
+    return value.String()
+}
@@ -0,0 +1,135 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+package app
+
+import (
+    "errors"
+    "strings"
+    "testing"
+    "time"
+)
+
+func Test_FormatValue(t *testing.T) {
+    config := &testConfig{}
+    configuration := NewConfiguration(config)
+
+    if err := configuration.Load("run", []string{"--password", "secret", "--interval", "90"}); err != nil {
+        t.Fatalf("Load() returned %v", err)
+    }
+
+    tests := []struct {
+        pointer  any
+        expected string
+    }{
+        {&config.General.MulticastIP4, `"224.0.0.1"`},
+        {&config.General.Port,         `54321`},
+        {&config.General.Password,     `"********"`},
+        {&config.Run.Interval,         `"1m30s"`},
+        {&config.Run.Verbose,          `false`},
+    }
+
+    for _, test := range tests {
+        value := configuration.Lookup(test.pointer)
+
+        if result := formatValue(value); result != test.expected {
+            t.Errorf("formatValue(%v) returned %v instead of %v", value.Key, result, test.expected)
+        }
+    }
+}
+
+func Test_RenderConfiguration(t *testing.T) {
+    t.Setenv("TEST_PORT", "1000")
+
+    config := &testConfig{}
+    configuration := NewConfiguration(config)
+
+    if err := configuration.Load("run", []string{"--device-name", "kitchen-pi"}); err != nil {
+        t.Fatalf("Load() returned %v", err)
+    }
+
+    text  := renderConfiguration(configuration.Values())
+    lines := strings.Split(text, "\n")
+
+    for _, expected := range []string{"[general]", "[run]"} {
+        if !strings.Contains(text, "\n" + expected + "\n") {
+            t.Errorf("Section %v is missing:\n%v", expected, text)
+        }
+    }
+
+    expected := map[string]string{
+        "port = 1000":                 "# env TEST_PORT",
+        `device_name = "kitchen-pi"`:  "# flag --device-name",
+        `interval = "15s"`:            "# default",
+        `password = ""`:               "# default",
+    }
+
+    for assignment, origin := range expected {
+        found := false
+
+        for _, line := range lines {
+            if !strings.HasPrefix(line, assignment + " ") { continue }
+            found = true
+
+            if !strings.HasSuffix(strings.TrimSpace(line), origin) {
+                t.Errorf("Line %q is not annotated with %q", line, origin)
+            }
+        }
+
+        if !found {
+            t.Errorf("Value %v is missing:\n%v", assignment, text)
+        }
+    }
+}
+
+func Test_ConfigCommandLoadsCommandFlags(t *testing.T) {
+    config := &testConfig{}
+    app    := NewApp(config)
+    app.AddCommand("run", newTestCommand())
+
+    if err := app.Run([]string{"fmd", "config", "run", "--interval", "5"}); err != nil {
+        t.Fatalf("Run() returned %v", err)
+    }
+
+    if config.Run.Interval != 5 * time.Second {
+        t.Errorf("Flag of the given command was not loaded: %v", config.Run.Interval)
+    }
+
+    if err := NewApp(&testConfig{}).Run([]string{"fmd", "config", "--interval", "5"}); err == nil {
+        t.Errorf("Flag of a command was accepted without the command name")
+    }
+}
+
+func Test_ConfigValidateDoesNotPrompt(t *testing.T) {
+    config := &testConfig{}
+    app    := NewApp(config)
+    command := newTestCommand()
+    prompts := false
+
+    command.validate = func() error {
+        prompts = !app.Configuration().(*ConfigurationStruct).noPrompt
+        if prompts { return errors.New("Validation could prompt") }
+
+        return app.Configuration().Require(true, &config.General.Password)
+    }
+
+    app.AddCommand("run", command)
+    err := app.Run([]string{"fmd", "config", "validate"})
+
+    if prompts {
+        t.Fatalf("Validation was allowed to ask for missing values")
+    }
+
+    if err == nil || !strings.Contains(err.Error(), "1 command(s) is invalid") {
+        t.Errorf("Missing value was not reported: %v", err)
+    }
+
+    if app.Configuration().(*ConfigurationStruct).noPrompt {
+        t.Errorf("Prompting was not allowed again after validation")
+    }
+}
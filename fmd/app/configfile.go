@@ -0,0 +1,458 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+package app
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strconv"
+    "strings"
+)
+
+// Config files contain one section per configuration section, e.g. [general]
+// or [advertise], with the configuration values as simple key/value pairs.
+// They can be written in a subset of TOML, YAML or JSON:
+//
+//      # TOML
+//      [advertise]
+//      interval = 30
+//      device_name = "kitchen-pi"
+//
+//      # YAML
+//      advertise:
+//        interval: 30
+//        device_name: kitchen-pi
+//
+//      // JSON
+//      {"advertise": {"interval": 30, "device_name": "kitchen-pi"}}
+//
+// The format is detected by the file extension (.toml, .yaml, .yml, .json)
+// or, for other extensions like .conf, by the content of the file.
+
+// Single key/value pair read from a config file
+type configEntry struct {
+    // Key with section, e.g. "advertise.interval"
+    Key string
+
+    // Value as text, without quotes
+    Text string
+
+    // Type of the value in the config file
+    Kind configEntryKind
+
+    // Line number for error messages
+    Line int
+}
+
+// Type of a value in the config file. The type is used to detect type
+// mismatches, e.g. a quoted string for a port number.
+type configEntryKind int
+
+const (
+    // Unquoted YAML value, that can be anything
+    entryPlain configEntryKind = iota
+    entryString
+    entryNumber
+    entryBool
+)
+
+// Error in a config file, with file name and line number
+type ConfigFileError struct {
+    File    string
+    Line    int
+    Message string
+}
+
+func (this *ConfigFileError) Error() string {
+    return fmt.Sprintf("%v:%v: %v", this.File, this.Line, this.Message)
+}
+
+// Expand "~/" at the beginning of a path to the home directory
+func expandPath(path string) string {
+    if !strings.HasPrefix(path, "~/") {
+        return path
+    }
+
+    home, err := os.UserHomeDir()
+    if err != nil { return path }
+
+    return filepath.Join(home, path[2:])
+}
+
+// Read config file and set all contained values. Returns an error that wraps
+// os.ErrNotExist, if the file doesn't exist.
+func (this *ConfigurationStruct) readFile(path string) error {
+    data, err := os.ReadFile(expandPath(path))
+    if err != nil { return err }
+
+    entries, err := parseConfigFile(path, data)
+    if err != nil { return err }
+
+    values := make(map[string]*ConfigValue)
+
+    for _, value := range this.values {
+        values[value.Key] = value
+    }
+
+    for _, entry := range entries {
+        value, found := values[entry.Key]
+
+        if !found {
+            return &ConfigFileError{File: path, Line: entry.Line, Message: fmt.Sprintf("Unknown key '%v'", entry.Key)}
+        }
+
+        if err := checkEntryKind(value, entry.Kind); err != nil {
+            return &ConfigFileError{File: path, Line: entry.Line, Message: fmt.Sprintf("%v: %v", entry.Key, err)}
+        }
+
+        if err := value.Set(entry.Text, SourceFile); err != nil {
+            return &ConfigFileError{File: path, Line: entry.Line, Message: fmt.Sprintf("%v: %v", entry.Key, err)}
+        }
+
+        value.Origin = fmt.Sprintf("%v:%v", path, entry.Line)
+    }
+
+    return nil
+}
+
+// Check that the type of a config file entry fits the configuration value
+func checkEntryKind(value *ConfigValue, kind configEntryKind) error {
+    if kind == entryPlain {
+        return nil
+    }
+
+    switch {
+        case value.Value.Type() == durationType:
+            if kind == entryBool { return fmt.Errorf("Expected a duration, not a boolean") }
+
+        case value.Value.Kind() == reflect.String:
+            if kind != entryString { return fmt.Errorf("Expected a quoted string") }
+
+        case value.Value.Kind() == reflect.Bool:
+            if kind != entryBool { return fmt.Errorf("Expected true or false") }
+
+        default:
+            if kind != entryNumber { return fmt.Errorf("Expected a number") }
+    }
+
+    return nil
+}
+
+// Parse config file in any of the supported formats
+func parseConfigFile(path string, data []byte) ([]configEntry, error) {
+    var entries []configEntry
+    var err error
+
+    switch detectConfigFormat(path, data) {
+        case "json":
+            entries, err = parseJSONConfig(data)
+        case "yaml":
+            entries, err = parseYAMLConfig(data)
+        default:
+            entries, err = parseTOMLConfig(data)
+    }
+
+    var fileError *ConfigFileError
+
+    if errors.As(err, &fileError) {
+        fileError.File = path
+    }
+
+    return entries, err
+}
+
+// Detect file format by file extension or content
+func detectConfigFormat(path string, data []byte) string {
+    switch strings.ToLower(filepath.Ext(path)) {
+        case ".json":
+            return "json"
+        case ".yaml", ".yml":
+            return "yaml"
+        case ".toml":
+            return "toml"
+    }
+
+    for _, line := range strings.Split(string(data), "\n") {
+        line = strings.TrimSpace(line)
+
+        switch {
+            case line == "" || strings.HasPrefix(line, "#"):
+                continue
+            case strings.HasPrefix(line, "{"):
+                return "json"
+            case strings.HasPrefix(line, "["):
+                return "toml"
+            case strings.HasSuffix(line, ":"):
+                return "yaml"
+        }
+
+        break
+    }
+
+    return "toml"
+}
+
+// Parse TOML subset: Sections, key/value pairs and comments
+func parseTOMLConfig(data []byte) ([]configEntry, error) {
+    entries := make([]configEntry, 0)
+    section := ""
+
+    for i, line := range strings.Split(string(data), "\n") {
+        line = strings.TrimSpace(line)
+
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+
+        if strings.HasPrefix(line, "[") {
+            end := strings.Index(line, "]")
+
+            if end < 0 || strings.TrimSpace(stripComment(line[end + 1:])) != "" {
+                return nil, &ConfigFileError{Line: i + 1, Message: "Invalid section header"}
+            }
+
+            section = strings.TrimSpace(line[1:end])
+            continue
+        }
+
+        key, text, found := strings.Cut(line, "=")
+
+        if !found {
+            return nil, &ConfigFileError{Line: i + 1, Message: "Expected key = value"}
+        }
+
+        entry, err := parseScalar(strings.TrimSpace(text), false)
+
+        if err != nil {
+            return nil, &ConfigFileError{Line: i + 1, Message: err.Error()}
+        }
+
+        entry.Key  = joinKey(section, strings.TrimSpace(key))
+        entry.Line = i + 1
+        entries = append(entries, entry)
+    }
+
+    return entries, nil
+}
+
+// Parse YAML subset: Top-level mappings with scalar values and comments
+func parseYAMLConfig(data []byte) ([]configEntry, error) {
+    entries := make([]configEntry, 0)
+    section := ""
+
+    for i, line := range strings.Split(string(data), "\n") {
+        trimmed := strings.TrimSpace(line)
+
+        if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+            continue
+        }
+
+        key, text, found := strings.Cut(trimmed, ":")
+
+        if !found {
+            return nil, &ConfigFileError{Line: i + 1, Message: "Expected key: value"}
+        }
+
+        key  = strings.TrimSpace(key)
+        text = strings.TrimSpace(text)
+        indented := line[0] == ' ' || line[0] == '\t'
+
+        if !indented {
+            if stripComment(text) != "" {
+                return nil, &ConfigFileError{Line: i + 1, Message: fmt.Sprintf("Expected section, not value for '%v'", key)}
+            }
+
+            section = key
+            continue
+        }
+
+        if section == "" {
+            return nil, &ConfigFileError{Line: i + 1, Message: "Value outside of a section"}
+        }
+
+        entry, err := parseScalar(text, true)
+
+        if err != nil {
+            return nil, &ConfigFileError{Line: i + 1, Message: err.Error()}
+        }
+
+        entry.Key  = joinKey(section, key)
+        entry.Line = i + 1
+        entries = append(entries, entry)
+    }
+
+    return entries, nil
+}
+
+// Parse JSON object with one nested object per section
+func parseJSONConfig(data []byte) ([]configEntry, error) {
+    entries := make([]configEntry, 0)
+    decoder := json.NewDecoder(bytes.NewReader(data))
+    decoder.UseNumber()
+
+    lineAt := func(offset int64) int {
+        return bytes.Count(data[:offset], []byte("\n")) + 1
+    }
+
+    fail := func(err error) error {
+        var syntaxError *json.SyntaxError
+
+        if errors.As(err, &syntaxError) {
+            return &ConfigFileError{Line: lineAt(syntaxError.Offset), Message: err.Error()}
+        } else if errors.Is(err, io.EOF) {
+            return &ConfigFileError{Line: lineAt(int64(len(data))), Message: "Unexpected end of file"}
+        }
+
+        return &ConfigFileError{Line: lineAt(decoder.InputOffset()), Message: err.Error()}
+    }
+
+    expect := func(delim json.Delim) error {
+        token, err := decoder.Token()
+        if err != nil { return fail(err) }
+
+        if token != delim {
+            return fail(fmt.Errorf("Expected '%v'", delim))
+        }
+
+        return nil
+    }
+
+    if err := expect('{'); err != nil { return nil, err }
+
+    for decoder.More() {
+        token, err := decoder.Token()
+        if err != nil { return nil, fail(err) }
+        section := token.(string)
+
+        if err := expect('{'); err != nil { return nil, err }
+
+        for decoder.More() {
+            token, err := decoder.Token()
+            if err != nil { return nil, fail(err) }
+
+            entry := configEntry{
+                Key:  joinKey(section, token.(string)),
+                Line: lineAt(decoder.InputOffset()),
+            }
+
+            token, err = decoder.Token()
+            if err != nil { return nil, fail(err) }
+
+            switch value := token.(type) {
+                case string:
+                    entry.Text, entry.Kind = value, entryString
+                case json.Number:
+                    entry.Text, entry.Kind = value.String(), entryNumber
+                case bool:
+                    entry.Text, entry.Kind = strconv.FormatBool(value), entryBool
+                default:
+                    return nil, fail(fmt.Errorf("Unsupported value for '%v'", entry.Key))
+            }
+
+            entries = append(entries, entry)
+        }
+
+        if err := expect('}'); err != nil { return nil, err }
+    }
+
+    if err := expect('}'); err != nil { return nil, err }
+    return entries, nil
+}
+
+// Parse a single scalar value, which can be a quoted string, a number, a
+// boolean or, if plain is true, any unquoted text until a trailing comment.
+func parseScalar(text string, plain bool) (configEntry, error) {
+    entry := configEntry{}
+
+    if strings.HasPrefix(text, "\"") || strings.HasPrefix(text, "'") {
+        quote := text[0]
+        end   := 1
+
+        for ; end < len(text); end++ {
+            if text[end] == '\\' && quote == '"' {
+                end++
+            } else if text[end] == quote {
+                if quote == '\'' && plain && end + 1 < len(text) && text[end + 1] == '\'' {
+                    end++
+                    continue
+                }
+
+                break
+            }
+        }
+
+        if end >= len(text) {
+            return entry, fmt.Errorf("Missing closing quote")
+        }
+
+        if strings.TrimSpace(stripComment(text[end + 1:])) != "" {
+            return entry, fmt.Errorf("Unexpected text after closing quote")
+        }
+
+        if quote == '"' {
+            unquoted, err := strconv.Unquote(text[:end + 1])
+            if err != nil { return entry, fmt.Errorf("Invalid string %v", text[:end + 1]) }
+            entry.Text = unquoted
+        } else if plain {
+            entry.Text = strings.ReplaceAll(text[1:end], "''", "'")
+        } else {
+            entry.Text = text[1:end]
+        }
+
+        entry.Kind = entryString
+        return entry, nil
+    }
+
+    text = strings.TrimSpace(stripComment(text))
+    entry.Text = text
+
+    switch {
+        case plain:
+            entry.Kind = entryPlain
+        case text == "true" || text == "false":
+            entry.Kind = entryBool
+        case text != "" && strings.Trim(text, "+-0123456789.") == "":
+            entry.Kind = entryNumber
+        default:
+            return entry, fmt.Errorf("Invalid value '%v', strings must be quoted", text)
+    }
+
+    return entry, nil
+}
+
+// Remove trailing comment from unquoted text
+func stripComment(text string) string {
+    if text == "" || text[0] == '#' {
+        return ""
+    }
+
+    if i := strings.Index(text, " #"); i >= 0 {
+        return text[:i]
+    }
+
+    return text
+}
+
+// Join section and key to a config key like "advertise.interval". Keys can
+// also be written with section outside of a section, e.g. in TOML.
+func joinKey(section, key string) string {
+    key = strings.ToLower(strings.ReplaceAll(key, "-", "_"))
+
+    if section == "" {
+        return key
+    }
+
+    return strings.ToLower(section) + "." + key
+}
@@ -0,0 +1,117 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+package app
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+func writeTestFile(t *testing.T, name, content string) string {
+    path := filepath.Join(t.TempDir(), name)
+
+    if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+        t.Fatalf("Cannot write test file: %v", err)
+    }
+
+    return path
+}
+
+func Test_ConfigFileFormats(t *testing.T) {
+    tests := make(map[string]string)
+
+    tests["fmd.toml"] = `
+        # Comment
+        [general]
+        port = 1000   # Comment
+
+        [run]
+        interval = "1m"
+        device_name = "kitchen-pi"
+        verbose = true
+    `
+
+    tests["fmd.yaml"] = `
+        general:
+          port: 1000
+        run:
+          interval: 1m
+          device_name: 'kitchen-pi'   # Comment
+          verbose: true
+    `
+
+    tests["fmd.json"] = `{
+        "general": {"port": 1000},
+        "run": {"interval": "1m", "device_name": "kitchen-pi", "verbose": true}
+    }`
+
+    for name, content := range tests {
+        content = strings.ReplaceAll(content, "\n        ", "\n")
+        path := writeTestFile(t, name, content)
+
+        // Also detect the format without file extension
+        for _, path := range []string{path, writeTestFile(t, "fmd.conf", content)} {
+            config := &testConfig{}
+            configuration := NewConfiguration(config)
+
+            if err := configuration.Load("run", []string{"--config", path}); err != nil {
+                t.Errorf("%v: Load() returned %v", name, err)
+                continue
+            }
+
+            if config.General.Port != 1000 || config.Run.Interval != time.Minute || config.Run.DeviceName != "kitchen-pi" || !config.Run.Verbose {
+                t.Errorf("%v: Wrong values %+v", name, config)
+            }
+        }
+    }
+}
+
+func Test_ConfigFileErrors(t *testing.T) {
+    tests := make(map[string]string)
+
+    tests["[run]\nunknown = 1\n"]            = "fmd.conf:2: Unknown key 'run.unknown'"
+    tests["[general]\n\nport = \"1000\"\n"] = "fmd.conf:3: general.port: Expected a number"
+    tests["[run]\ndevice_name = kitchen\n"]  = "fmd.conf:2: Invalid value 'kitchen', strings must be quoted"
+    tests["{\n\"run\": {\n\"verbose\": 1}}"] = "fmd.conf:3: run.verbose: Expected true or false"
+    tests["run:\n  interval: soon\n"]        = "fmd.conf:2: run.interval: Invalid duration 'soon'"
+
+    for content, expected := range tests {
+        path := writeTestFile(t, "fmd.conf", content)
+        err  := NewConfiguration(&testConfig{}).Load("run", []string{"--config=" + path})
+
+        if err == nil || !strings.HasSuffix(err.Error(), expected) {
+            t.Errorf("Config file %q returned error %v instead of %v", content, err, expected)
+        }
+    }
+}
+
+func Test_ConfigFilePrecedence(t *testing.T) {
+    t.Setenv("TEST_RUN_DEVICE_NAME", "from-env")
+
+    config := &testConfig{}
+    configuration := NewConfiguration(config)
+    configuration.AddFile(writeTestFile(t, "first.toml", "[run]\ndevice_name = \"first\"\ninterval = 1\n"))
+    configuration.AddFile(writeTestFile(t, "second.toml", "[run]\ninterval = 2\n"))
+    configuration.AddFile(filepath.Join(t.TempDir(), "missing.toml"))
+
+    if err := configuration.Load("run", []string{}); err != nil {
+        t.Fatalf("Load() returned %v", err)
+    }
+
+    if config.Run.DeviceName != "from-env" {
+        t.Errorf("Env variable didn't overwrite config file: %v", config.Run.DeviceName)
+    }
+
+    if config.Run.Interval != 2 * time.Second {
+        t.Errorf("Second config file didn't overwrite first: %v", config.Run.Interval)
+    }
+}
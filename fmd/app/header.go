@@ -0,0 +1,103 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+package app
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "strings"
+)
+
+// Print the startup banner of a command, either as text or JSON
+func printHeader(app App, header *CommandHeader) error {
+    if header == nil || header.Quiet {
+        return nil
+    }
+
+    values := make([]*ConfigValue, 0)
+
+    for _, pointer := range header.Values {
+        value := app.Configuration().Lookup(pointer)
+
+        if value == nil {
+            panic(fmt.Sprintf("Header value %v is not a configuration value", pointer))
+        }
+
+        values = append(values, value)
+    }
+
+    if header.JSON {
+        text, err := renderJSONHeader(app.Command(), header.Title, values)
+        if err != nil { return err }
+        fmt.Fprintln(os.Stdout, text)
+    } else {
+        fmt.Fprintln(os.Stdout, renderTextHeader(header.Title, values))
+    }
+
+    return nil
+}
+
+// Render banner as human-readable text, with the flag names as labels:
+//
+//      Title
+//      =====
+//
+//       - port:     54321
+//       - interval: 15s
+func renderTextHeader(title string, values []*ConfigValue) string {
+    builder := strings.Builder{}
+
+    builder.WriteString(title)
+    builder.WriteString("\n")
+    builder.WriteString(strings.Repeat("=", len([]rune(title))))
+    builder.WriteString("\n")
+
+    if len(values) > 0 {
+        builder.WriteString("\n")
+    }
+
+    width := 0
+
+    for _, value := range values {
+        if len(value.Flag) > width { width = len(value.Flag) }
+    }
+
+    for _, value := range values {
+        label := value.Flag + ":"
+        line  := fmt.Sprintf(" - %-*v %v", width + 1, label, value.Display())
+        builder.WriteString(strings.TrimRight(line, " "))
+        builder.WriteString("\n")
+    }
+
+    return builder.String()
+}
+
+// Render banner as a single line of JSON with the config file keys:
+//
+//      {"command":"advertise","title":"...","config":{"general.port":54321}}
+func renderJSONHeader(command, title string, values []*ConfigValue) (string, error) {
+    config := make(map[string]any)
+
+    for _, value := range values {
+        if value.Hide || value.Value.Type() == durationType {
+            config[value.Key] = value.Display()
+        } else {
+            config[value.Key] = value.Value.Interface()
+        }
+    }
+
+    data, err := json.Marshal(map[string]any{
+        "command": command,
+        "title":   title,
+        "config":  config,
+    })
+
+    return string(data), err
+}
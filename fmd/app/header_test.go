@@ -0,0 +1,95 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+package app
+
+import (
+    "encoding/json"
+    "strings"
+    "testing"
+)
+
+// Get configuration values for the header tests with a set password
+func newTestHeaderValues(t *testing.T) []*ConfigValue {
+    config := &testConfig{}
+    configuration := NewConfiguration(config)
+
+    if err := configuration.Load("run", []string{"--password", "secret"}); err != nil {
+        t.Fatalf("Load() returned %v", err)
+    }
+
+    return []*ConfigValue{
+        configuration.Lookup(&config.General.Port),
+        configuration.Lookup(&config.General.Password),
+        configuration.Lookup(&config.Run.Interval),
+    }
+}
+
+func Test_RenderTextHeader(t *testing.T) {
+    text := renderTextHeader("Run täst", newTestHeaderValues(t))
+
+    expected := "Run täst\n" +
+                "========\n" +
+                "\n" +
+                " - port:     54321\n" +
+                " - password: ********\n" +
+                " - interval: 15s\n"
+
+    if text != expected {
+        t.Errorf("renderTextHeader() returned\n%v\ninstead of\n%v", text, expected)
+    }
+
+    if text := renderTextHeader("Run", nil); text != "Run\n===\n" {
+        t.Errorf("renderTextHeader() without values returned %q", text)
+    }
+}
+
+func Test_RenderJSONHeader(t *testing.T) {
+    text, err := renderJSONHeader("run", "Run", newTestHeaderValues(t))
+    if err != nil { t.Fatalf("renderJSONHeader() returned %v", err) }
+
+    if strings.Contains(text, "\n") {
+        t.Errorf("renderJSONHeader() returned more than one line: %v", text)
+    }
+
+    if strings.Contains(text, "secret") {
+        t.Errorf("renderJSONHeader() revealed hidden value: %v", text)
+    }
+
+    var header struct {
+        Command string
+        Title   string
+        Config  map[string]any
+    }
+
+    if err := json.Unmarshal([]byte(text), &header); err != nil {
+        t.Fatalf("renderJSONHeader() returned invalid JSON: %v", err)
+    }
+
+    if header.Command != "run" || header.Title != "Run" || len(header.Config) != 3 {
+        t.Errorf("Wrong command, title or number of values: %v", text)
+    }
+
+    expected := map[string]any{
+        "general.port":     float64(54321),
+        "general.password": "********",
+        "run.interval":     "15s",
+    }
+
+    for key, value := range expected {
+        if header.Config[key] != value {
+            t.Errorf("Value of %v is %#v instead of %#v", key, header.Config[key], value)
+        }
+    }
+
+    for _, key := range []string{`"command"`, `"title"`, `"config"`} {
+        if !strings.Contains(text, key) {
+            t.Errorf("renderJSONHeader() is missing the key %v: %v", key, text)
+        }
+    }
+}
@@ -10,9 +10,11 @@ package app
 
 import (
     "fmt"
+    "reflect"
+    "sort"
     "strings"
+    "golang.org/x/exp/maps"
     "github.com/DennisSchulmeister/find-my-device/fmd/str"
-    //"golang.org/x/exp/maps"
 )
 
 // Build in help command. Either shows a list of all available commands or the
@@ -58,7 +60,23 @@ func (this *HelpCommandStruct) Run(app App) error {
 }
 
 func (this *HelpCommandStruct) showListOfCommands() {
-    // TODO: Print list of available commands
+    names := maps.Keys(this.app.Commands())
+    sort.Strings(names)
+
+    table := str.NewTable()
+    table.Indent = "  "
+
+    for _, name := range names {
+        table.AddRow(name, this.app.Commands()[name].Help().Description)
+    }
+
+    fmt.Printf("Usage: %v <command> [<arguments...>] [<flags...>]\n", this.app.Program())
+    fmt.Println()
+    fmt.Println("Available commands:")
+    fmt.Println()
+    fmt.Print(table.String())
+    fmt.Println()
+    fmt.Printf("Use '%v help <command>' to get help for a single command.\n", this.app.Program())
 }
 
 func (this *HelpCommandStruct) showCommandHelp(name string) error {
@@ -80,8 +98,72 @@ func (this *HelpCommandStruct) showCommandHelp(name string) error {
     fmt.Println()
     fmt.Println(text)
 
-    // TODO: Print flag list (with empty line between general and command flags)
-    // TODO: Print mapping table that maps flags to env variables and config file entries
+    // Print flag lists
+    generalFlags := str.NewTable()
+    generalFlags.Indent = "  "
+    generalFlags.AddRow("--config <file>", "Read configuration from the given file only")
+
+    commandFlags := str.NewTable()
+    commandFlags.Indent = "  "
+
+    mapping := str.NewTable("Flag", "Env variable", "Config file", "Current value")
+    mapping.Indent = "  "
+
+    values := this.app.Configuration().ValuesFor(name)
+
+    for _, value := range values {
+        help := value.Help
+
+        if value.Default != "" && !value.Hide {
+            help = fmt.Sprintf("%v (default: %v)", help, value.Default)
+        } else if value.Hide && value.Value.Kind() == reflect.String {
+            help = fmt.Sprintf("%v (asked for, if given without value)", help)
+        }
+
+        if value.Command == "" {
+            generalFlags.AddRow(flagUsage(value), help)
+        } else {
+            commandFlags.AddRow(flagUsage(value), help)
+        }
+
+        mapping.AddRow("--" + value.Flag, value.Env, value.Key, value.Display())
+    }
+
+    fmt.Println()
+    fmt.Println("General flags:")
+    fmt.Println()
+    fmt.Print(generalFlags.String())
+
+    if len(values) > len(this.app.Configuration().ValuesFor("")) {
+        fmt.Println()
+        fmt.Println("Command flags:")
+        fmt.Println()
+        fmt.Print(commandFlags.String())
+    }
+
+    // Print mapping table that maps flags to env variables and config file entries
+    if len(values) > 0 {
+        fmt.Println()
+        fmt.Println("All flags can also be set as environment variables or in the config file:")
+        fmt.Println()
+        fmt.Print(mapping.String())
+    }
 
     return nil
 }
+
+// Flag name with placeholder for its value, e.g. "--interval <seconds>"
+func flagUsage(value *ConfigValue) string {
+    switch {
+        case value.Value.Type() == durationType:
+            return fmt.Sprintf("--%v <seconds>", value.Flag)
+        case value.Value.Kind() == reflect.Bool:
+            return fmt.Sprintf("--%v[=false]", value.Flag)
+        case value.Value.CanInt() || value.Value.CanUint():
+            return fmt.Sprintf("--%v <number>", value.Flag)
+        case value.Hide:
+            return fmt.Sprintf("--%v [<text>]", value.Flag)
+        default:
+            return fmt.Sprintf("--%v <text>", value.Flag)
+    }
+}
@@ -0,0 +1,66 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+package app
+
+import (
+    "bufio"
+    "errors"
+    "fmt"
+    "os"
+    "strings"
+    "golang.org/x/term"
+)
+
+// Shared reader for all prompts, so that no buffered input gets lost
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// Error for prompts, when the standard input is not a terminal
+var errNoTerminal = errors.New("Standard input is not a terminal")
+
+// Check, whether the user can be asked to enter values on the console
+func canPrompt() bool {
+    return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// Ask the user to enter a configuration value on the console. Hidden values
+// like passwords are read without echo.
+func promptValue(value *ConfigValue) error {
+    if !canPrompt() {
+        return errNoTerminal
+    }
+
+    for {
+        fmt.Fprintf(os.Stderr, "%v (--%v): ", value.Help, value.Flag)
+
+        var text string
+        var err error
+
+        if value.Hide {
+            var bytes []byte
+            bytes, err = term.ReadPassword(int(os.Stdin.Fd()))
+            text = string(bytes)
+            fmt.Fprintln(os.Stderr)
+        } else {
+            text, err = stdinReader.ReadString('\n')
+        }
+
+        if err != nil { return err }
+
+        if err = value.Set(strings.TrimSpace(text), SourcePrompt); err == nil {
+            return nil
+        }
+
+        fmt.Fprintf(os.Stderr, "%v\n", err)
+    }
+}
+
+// Error message for a missing value, telling the user how to set it
+func missingValueError(value *ConfigValue) string {
+    return fmt.Sprintf("Missing value for --%v (%v or %v in the config file): %v", value.Flag, value.Env, value.Key, value.Help)
+}
@@ -0,0 +1,75 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+package app
+
+import (
+    "strings"
+    "testing"
+)
+
+func Test_RequireNonInteractive(t *testing.T) {
+    config := &testConfig{}
+    configuration := NewConfiguration(config)
+
+    if err := configuration.Load("run", []string{}); err != nil {
+        t.Fatalf("Load() returned %v", err)
+    }
+
+    config.Run.DeviceName = ""
+    err := configuration.Require(false, &config.General.Port, &config.General.Password, &config.Run.DeviceName)
+
+    if err == nil {
+        t.Fatalf("Require() accepted missing values")
+    }
+
+    lines := strings.Split(err.Error(), "\n")
+
+    if len(lines) != 2 {
+        t.Fatalf("Require() didn't report both missing values: %v", err)
+    }
+
+    for _, expected := range []string{"--password", "TEST_PASSWORD", "general.password", "Password"} {
+        if !strings.Contains(lines[0], expected) {
+            t.Errorf("Error message %q doesn't contain %q", lines[0], expected)
+        }
+    }
+
+    if !strings.Contains(lines[1], "--device-name") {
+        t.Errorf("Error message %q doesn't name --device-name", lines[1])
+    }
+
+    config.General.Password = "secret"
+    config.Run.DeviceName   = "device"
+
+    if err := configuration.Require(false, &config.General.Password, &config.Run.DeviceName); err != nil {
+        t.Errorf("Require() returned %v for set values", err)
+    }
+
+    if !canPrompt() {
+        config.General.Password = ""
+
+        if err := configuration.Require(true, &config.General.Password); err == nil {
+            t.Errorf("Require() accepted missing value without terminal")
+        }
+    }
+}
+
+func Test_RequireInvalidPointer(t *testing.T) {
+    config := &testConfig{}
+    configuration := NewConfiguration(config)
+    other := ""
+
+    defer func() {
+        if recover() == nil {
+            t.Errorf("Require() didn't panic for a pointer that is no configuration value")
+        }
+    }()
+
+    configuration.Require(false, &other)
+}
@@ -9,12 +9,13 @@
 package advertise
 
 import (
+    "context"
+    "errors"
     "fmt"
     "log"
     "net"
     "os"
     "runtime"
-    "strings"
     "time"
     "github.com/DennisSchulmeister/find-my-device/fmd/app"
     "github.com/DennisSchulmeister/find-my-device/fmd/conf"
@@ -28,6 +29,9 @@ type AdvertiseCommandStruct struct {
 
     app    app.App
     config *conf.Config
+
+    // Last advertised device, to say goodbye when it is renamed
+    announced *msg.DeviceAdvertisementMessage
 }
 
 // Create new command instance
@@ -37,6 +41,8 @@ func New(config *conf.Config) app.Command {
     }
 
     this.CommandStruct.Steps = this
+    this.CommandStruct.StopTimeout = &config.General.StopTimeout
+    this.CommandStruct.Reloadable  = true
     return this
 }
 
@@ -55,25 +61,46 @@ func (this *AdvertiseCommandStruct) App(app app.App) {
     this.app = app
 }
 
-// Return header string with name and configuration
-func (this *AdvertiseCommandStruct) Header() string {
-    builder := strings.Builder{}
-
-    builder.WriteString("Advertise device information\n")
-    builder.WriteString("============================\n")
-    builder.WriteString("\n")
-    builder.WriteString(fmt.Sprintf(" - IPv4 multicast address for local network communication: %v\n", this.config.General.MulticastIP4))
-    builder.WriteString(fmt.Sprintf(" - IPv6 multicast address for local network communication: %v\n", this.config.General.MulticastIP6))
-    builder.WriteString(fmt.Sprintf(" - UDP port for local network communication: %v\n", this.config.General.Port))
-    builder.WriteString(fmt.Sprintf(" - Respond to queries on the local network: %v\n", this.config.Advertise.Respond))
-    builder.WriteString(fmt.Sprintf(" - Send advertisement multicasts on the local network: %v\n", this.config.Advertise.Multicast))
-    builder.WriteString(fmt.Sprintf(" - Seconds between advertisements: %v\n", this.config.Advertise.Interval * time.Second))
-
-    return builder.String()
+// Return title and configuration values for the startup banner
+func (this *AdvertiseCommandStruct) Header() *app.CommandHeader {
+    return &app.CommandHeader{
+        Title: "Advertise device information",
+        Quiet: this.config.General.Quiet,
+        JSON:  this.config.General.JSON,
+        Values: []any{
+            &this.config.General.MulticastIP4,
+            &this.config.General.MulticastIP6,
+            &this.config.General.Port,
+            &this.config.General.Encoding,
+            &this.config.Advertise.Respond,
+            &this.config.Advertise.Multicast,
+            &this.config.Advertise.Burst,
+            &this.config.Advertise.Interval,
+            &this.config.Advertise.MaxInterval,
+            &this.config.Advertise.Jitter,
+            &this.config.Advertise.Group,
+            &this.config.Advertise.DeviceName,
+        },
+    }
 }
 
 // Check configuration values
 func (this *AdvertiseCommandStruct) Validate() error {
+    if this.config.Advertise.Registry {
+        err := this.app.Configuration().Require(this.config.General.Interactive, &this.config.General.Username, &this.config.General.Password)
+        if err != nil { return err }
+    }
+
+    if this.config.Advertise.Multicast {
+        if this.config.Advertise.Interval <= 0 {
+            return fmt.Errorf("The advertisement interval must be positive")
+        }
+
+        if this.config.Advertise.Jitter > 100 {
+            return fmt.Errorf("The jitter must be between 0 and 100 percent")
+        }
+    }
+
     if this.config.Advertise.Respond || this.config.Advertise.Multicast {
         return msg.ValidateConfig(this.config)
     }
@@ -96,53 +123,270 @@ func (this *AdvertiseCommandStruct) Go() []app.CommandFunc {
     return functions
 }
 
-// Send periodic device announcements on the local network
-func (this *AdvertiseCommandStruct) sendLocalAnnouncements() error {
+// Send periodic device announcements on the local network, see
+// announcementSchedule for the timing. When network interfaces or addresses
+// change, the multicast connections are dialled again and the device sends
+// its device information and a new announcement immediately. On shutdown and
+// when the device is renamed by a configuration reload, a goodbye message is
+// sent, so that listeners know immediately that the device is gone. Without
+// any usable network interface nothing is sent until an interface appears.
+func (this *AdvertiseCommandStruct) sendLocalAnnouncements(ctx context.Context) error {
     // Create network connections
+    conns := this.dialMulticast()
+    defer func() { conns.Close() }()
+
+    // Say goodbye with the previous name, if the device has been renamed
+    message := this.newDeviceAdvertisementMessage()
+    message.Header.Flags = msg.EncodingFlags(this.config.General.Encoding)
+    this.setAnnounced(conns, message.DeviceAdvertisement)
+
+    // Send advertisement datagrams according to the schedule
+    schedule := newAnnouncementSchedule(&this.config.Advertise)
+    network  := networkState()
+
+    timer := time.NewTimer(schedule.next())
+    defer timer.Stop()
+
+    check := time.NewTicker(networkCheckInterval)
+    defer check.Stop()
+
+    for {
+        select {
+            case <- ctx.Done():
+                if !this.Reloading() {
+                    this.sendGoodbye(conns, this.announced)
+                    this.announced = nil
+                }
+
+                return nil
+
+            case <- timer.C:
+                if err := this.sendAnnouncement(conns, message); err != nil { return err }
+                timer.Reset(schedule.next())
+
+            case <- check.C:
+                current := networkState()
+                if current == network { continue }
+
+                log.Println("Network interfaces or addresses have changed")
+                network = current
+
+                conns.Close()
+                conns = this.dialMulticast()
+
+                this.sendDeviceInformation(conns)
+                if err := this.sendAnnouncement(conns, message); err != nil { return err }
+                schedule.restart()
+
+                if !timer.Stop() {
+                    select {
+                        case <- timer.C:
+                        default:
+                    }
+                }
+
+                timer.Reset(schedule.next())
+        }
+    }
+}
+
+// Remember the announced device. If it has been renamed by a configuration
+// reload, a goodbye message with the previous name is sent first.
+func (this *AdvertiseCommandStruct) setAnnounced(conns msg.Connections, advertisement *msg.DeviceAdvertisementMessage) {
+    if this.announced != nil && *this.announced != *advertisement {
+        this.sendGoodbye(conns, this.announced)
+    }
+
+    this.announced = advertisement
+}
+
+// Dial the multicast addresses on all currently available network interfaces.
+// If this is not possible, e.g. because no interface is up, the returned
+// connections are empty until the network changes.
+func (this *AdvertiseCommandStruct) dialMulticast() msg.Connections {
     conns, err := msg.DialMulticast(this.config)
-    if err != nil { return err }
-    defer conns.Close()
 
-    fmt.Println()
+    if err != nil {
+        log.Printf("%v. Waiting for network interfaces", err)
+        return msg.NewConnections()
+    }
+
     for _, conn := range conns.Connections() {
-        fmt.Printf("Advertisement multicasts will be sent to %v\n", conn.RemoteAddr())
+        log.Printf("Advertisement multicasts will be sent to %v via %v", conns.RemoteAddr(conn), conns.Interface(conn))
     }
-    fmt.Println()
 
-    // Periodically send advertisement datagrams
-    messageCoder, err := msg.NewMessageCoder(nil, conns)
+    return conns
+}
+
+// Send a single device announcement
+func (this *AdvertiseCommandStruct) sendAnnouncement(conns msg.Connections, message msg.Message) error {
+    if len(conns.Connections()) == 0 { return nil }
+    log.Println("Sending advertisement multicast")
+
+    data, err := msg.EncodeDatagram(message)
     if err != nil { return err }
 
-    for {
-        // Send advertisements
-        log.Println("Sending advertisement multicast")
+    if _, err := conns.Write(data); err != nil {
+        log.Printf("%v", err)
+    }
+
+    return nil
+}
+
+// Send the full device information to all listeners, e.g. after the network
+// addresses have changed
+func (this *AdvertiseCommandStruct) sendDeviceInformation(conns msg.Connections) {
+    if len(conns.Connections()) == 0 { return }
+    log.Println("Sending device information multicast")
 
-        message := this.newDeviceAdvertisementMessage()
+    message := this.newDeviceInformationMessage()
+    message.Header.Flags = msg.EncodingFlags(this.config.General.Encoding)
+
+    fragments, err := msg.EncodeDatagrams(message)
+
+    if err != nil {
+        log.Printf("%v", err)
+        return
+    }
 
-        if err := messageCoder.Write(message); err != nil {
+    for _, data := range fragments {
+        if _, err := conns.Write(data); err != nil {
             log.Printf("%v", err)
+            return
         }
+    }
+}
+
+// Send goodbye message for a previously advertised device
+func (this *AdvertiseCommandStruct) sendGoodbye(conns msg.Connections, advertisement *msg.DeviceAdvertisementMessage) {
+    if len(conns.Connections()) == 0 { return }
+    log.Printf("Sending goodbye multicast for device %v", advertisement.DeviceName)
+
+    message := msg.Message{DeviceGoodbye: &msg.DeviceGoodbyeMessage{
+        Group:      advertisement.Group,
+        DeviceName: advertisement.DeviceName,
+        HostName:   advertisement.HostName,
+    }}
+
+    message.Header.Flags = msg.EncodingFlags(this.config.General.Encoding)
 
-        // Wait for notification or timeout
-        var action string
+    data, err := msg.EncodeDatagram(message)
 
+    if err != nil {
+        log.Printf("%v", err)
+        return
+    }
+
+    if _, err := conns.Write(data); err != nil {
+        log.Printf("%v", err)
+    }
+}
+
+// Answer find requests on the local network. Requests are received via the
+// multicast groups and answered via unicast to the requesting client. When
+// network interfaces change, the multicast groups are joined again.
+func (this *AdvertiseCommandStruct) respondToLocalRequests(ctx context.Context) error {
+    // Create network connections
+    conns := this.listenMulticast()
+    defer func() { conns.Close() }()
+
+    // Answer matching requests
+    coder   := msg.NewMessageCoder()
+    network := networkState()
+
+    check := time.NewTicker(networkCheckInterval)
+    defer check.Stop()
+
+    for {
         select {
-            case action = <- this.CommandStruct.Notify:
-            case <- time.After(this.config.Advertise.Interval * time.Second):
-                action = "send"
+            case <- ctx.Done():
+                return nil
+
+            case <- check.C:
+                current := networkState()
+                if current == network { continue }
+                network = current
+
+                conns.Close()
+                conns = this.listenMulticast()
+
+            case datagram := <- conns.Read():
+                if datagram.Error != nil {
+                    log.Printf("%v", datagram.Error)
+                    continue
+                }
+
+                message, err := coder.Decode(datagram.Data)
+
+                if errors.Is(err, msg.ErrNotFMD) || errors.Is(err, msg.ErrIncomplete) {
+                    continue
+                } else if err != nil {
+                    log.Printf("Ignoring datagram from %v: %v", datagram.Address, err)
+                    continue
+                }
+
+                if message.ClientRequest != nil {
+                    this.answerRequest(message, datagram)
+                }
         }
+    }
+}
 
-        if action == "quit" {
-            break
-        }
+// Join the multicast groups on all currently available network interfaces
+// and start receiving. If this is not possible, the returned connections are
+// empty until the network changes.
+func (this *AdvertiseCommandStruct) listenMulticast() msg.Connections {
+    conns, err := msg.ListenMulticast(this.config)
+
+    if err != nil {
+        log.Printf("%v. Waiting for network interfaces", err)
+        return msg.NewConnections()
+    }
+
+    for _, conn := range conns.Connections() {
+        log.Printf("Listening for find requests on %v", conns.RemoteAddr(conn))
     }
 
-    return messageCoder.Close()
+    conns.Start()
+    return conns
 }
 
-// Answer find requests on the local network
-func (this *AdvertiseCommandStruct) respondToLocalRequests() error {
-    return nil
+// Send device information to the client, if the request matches this device.
+// The answer contains the message ID of the request, so that the client can
+// tell apart the answers to different requests. It uses the same encoding as
+// the request, which the client therefore understands.
+func (this *AdvertiseCommandStruct) answerRequest(requestMessage msg.Message, datagram msg.Datagram) {
+    request := requestMessage.ClientRequest
+
+    if request.Request != msg.RequestDeviceInformation {
+        log.Printf("Ignoring unknown request '%v' from %v", request.Request, datagram.Address)
+        return
+    }
+
+    message := this.newDeviceInformationMessage()
+    message.InReplyTo = requestMessage.Header.MessageID
+    message.Header.Flags = requestMessage.Header.Flags & msg.FlagCBOR
+    information := message.DeviceInformation
+
+    if !request.Matches(information.Group, information.DeviceName, information.HostName) {
+        return
+    }
+
+    fragments, err := msg.EncodeDatagrams(message)
+
+    if err != nil {
+        log.Printf("%v", err)
+        return
+    }
+
+    log.Printf("Sending device information to %v", datagram.Address)
+
+    for _, data := range fragments {
+        if _, err := datagram.Connection.WriteTo(data, datagram.Address); err != nil {
+            log.Printf("%v", err)
+            return
+        }
+    }
 }
 
 // Create new device advertisement message
@@ -179,9 +423,11 @@ func (this *AdvertiseCommandStruct) newDeviceInformationMessage() msg.Message {
     if err != nil { log.Printf("%v", err) }
 
     if message.DeviceInformation.DeviceName == "" {
-        message.DeviceInformation.DeviceName = message.DeviceAdvertisement.HostName
+        message.DeviceInformation.DeviceName = message.DeviceInformation.HostName
     }
 
+    addSystemDetails(message.DeviceInformation, &this.config.Advertise)
+
     // Network information
     message.DeviceInformation.NetworkInterfaces = make([]msg.NetworkInterface, 0)
 
@@ -215,6 +461,8 @@ func (this *AdvertiseCommandStruct) newDeviceInformationMessage() msg.Message {
 
             networkInterface.Multicast = append(networkInterface.Multicast, networkMulticast)
         }
+
+        message.DeviceInformation.NetworkInterfaces = append(message.DeviceInformation.NetworkInterfaces, networkInterface)
     }
 
     return message
@@ -0,0 +1,72 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+package advertise
+
+import (
+    "net"
+    "testing"
+    "github.com/DennisSchulmeister/find-my-device/fmd/conf"
+    "github.com/DennisSchulmeister/find-my-device/fmd/msg"
+)
+
+// Connections that remember the written datagrams instead of sending them
+type testConnections struct {
+    written [][]byte
+}
+
+func (this *testConnections) Connections() []net.PacketConn        { return []net.PacketConn{nil} }
+func (this *testConnections) RemoteAddr(net.PacketConn) net.Addr   { return nil }
+func (this *testConnections) Interface(net.PacketConn) string      { return "" }
+func (this *testConnections) Start()                               {}
+func (this *testConnections) Stop()                                {}
+func (this *testConnections) Read() chan msg.Datagram              { return nil }
+func (this *testConnections) Close() error                         { return nil }
+
+func (this *testConnections) Write(b []byte) (int, error) {
+    this.written = append(this.written, append([]byte{}, b...))
+    return len(b), nil
+}
+
+func Test_GoodbyeOnRename(t *testing.T) {
+    command := New(&conf.Config{}).(*AdvertiseCommandStruct)
+    conns   := &testConnections{}
+
+    kitchen := &msg.DeviceAdvertisementMessage{Group: "home", DeviceName: "kitchen-pi", HostName: "pi"}
+    command.setAnnounced(conns, kitchen)
+
+    if len(conns.written) != 0 {
+        t.Fatalf("Goodbye sent for the first announced device")
+    }
+
+    command.setAnnounced(conns, &msg.DeviceAdvertisementMessage{Group: "home", DeviceName: "kitchen-pi", HostName: "pi"})
+
+    if len(conns.written) != 0 {
+        t.Fatalf("Goodbye sent although the device has not been renamed")
+    }
+
+    garage := &msg.DeviceAdvertisementMessage{Group: "home", DeviceName: "garage-pi", HostName: "pi"}
+    command.setAnnounced(conns, garage)
+
+    if len(conns.written) != 1 {
+        t.Fatalf("%v datagrams sent on rename instead of one goodbye", len(conns.written))
+    }
+
+    message, err := msg.DecodeDatagram(conns.written[0])
+    if err != nil { t.Fatalf("DecodeDatagram() returned %v", err) }
+
+    goodbye := message.DeviceGoodbye
+
+    if goodbye == nil || goodbye.DeviceName != "kitchen-pi" || goodbye.Group != "home" || goodbye.HostName != "pi" {
+        t.Errorf("Wrong goodbye message on rename: %+v", goodbye)
+    }
+
+    if command.announced != garage {
+        t.Errorf("Renamed device is not remembered as announced")
+    }
+}
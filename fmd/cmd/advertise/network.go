@@ -0,0 +1,46 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+package advertise
+
+import (
+    "fmt"
+    "net"
+    "sort"
+    "strings"
+    "time"
+)
+
+// Time between the checks for changed network interfaces and addresses
+const networkCheckInterval = 5 * time.Second
+
+// Get the network interfaces of the host with their state and addresses as
+// a single string. The network is polled with this function to detect, when
+// interfaces come and go (e.g. when a laptop switches from Wi-Fi to Ethernet)
+// or when addresses change.
+func networkState() string {
+    netInterfaces, err := net.Interfaces()
+    if err != nil { return "" }
+
+    list := make([]string, 0)
+
+    for _, netInterface := range netInterfaces {
+        addresses := make([]string, 0)
+        netAddresses, _ := netInterface.Addrs()
+
+        for _, netAddress := range netAddresses {
+            addresses = append(addresses, netAddress.String())
+        }
+
+        sort.Strings(addresses)
+        list = append(list, fmt.Sprintf("%v(%v)=%v", netInterface.Name, netInterface.Flags, strings.Join(addresses, ",")))
+    }
+
+    sort.Strings(list)
+    return strings.Join(list, ";")
+}
@@ -0,0 +1,90 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+package advertise
+
+import (
+    "math/rand"
+    "time"
+    "github.com/DennisSchulmeister/find-my-device/fmd/conf"
+)
+
+// Time between the announcements of the startup burst
+const burstInterval = time.Second
+
+// Schedule of the device announcements, so that a fleet of devices booting at
+// the same time doesn't flood the network in lock-step:
+//
+//  * The first announcement is sent after a random delay of up to one second.
+//  * Then a burst of quick announcements follows, one per second.
+//  * Then the interval starts at Advertise.Interval and doubles with each
+//    announcement up to Advertise.MaxInterval.
+//  * All intervals vary randomly by Advertise.Jitter percent.
+type announcementSchedule struct {
+    config   *conf.AdvertiseConfig
+    random   *rand.Rand
+    count    uint32
+    interval time.Duration
+}
+
+// Create new schedule starting with the startup burst
+func newAnnouncementSchedule(config *conf.AdvertiseConfig) *announcementSchedule {
+    return &announcementSchedule{
+        config: config,
+        random: rand.New(rand.NewSource(time.Now().UnixNano())),
+    }
+}
+
+// Get time to wait before the next announcement
+func (this *announcementSchedule) next() time.Duration {
+    var delay time.Duration
+
+    switch {
+        case this.count == 0:
+            this.count++
+            return time.Duration(this.random.Int63n(int64(burstInterval)))
+
+        case this.count < this.config.Burst:
+            delay = burstInterval
+
+        case this.interval == 0:
+            this.interval = this.config.Interval
+            delay = this.interval
+
+        default:
+            this.interval *= 2
+
+            if this.interval > this.config.MaxInterval {
+                this.interval = this.config.MaxInterval
+            }
+
+            if this.interval < this.config.Interval {
+                this.interval = this.config.Interval
+            }
+
+            delay = this.interval
+    }
+
+    this.count++
+    return this.jitter(delay)
+}
+
+// Start a new burst after an announcement has been sent out of schedule,
+// e.g. because the network addresses have changed
+func (this *announcementSchedule) restart() {
+    this.count    = 1
+    this.interval = 0
+}
+
+// Randomly vary the delay by the configured percentage
+func (this *announcementSchedule) jitter(delay time.Duration) time.Duration {
+    jitter := int64(delay) * int64(this.config.Jitter) / 100
+    if jitter <= 0 { return delay }
+
+    return delay + time.Duration(this.random.Int63n(2 * jitter + 1) - jitter)
+}
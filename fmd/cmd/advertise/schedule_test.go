@@ -0,0 +1,63 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+package advertise
+
+import (
+    "testing"
+    "time"
+    "github.com/DennisSchulmeister/find-my-device/fmd/conf"
+)
+
+func Test_AnnouncementSchedule(t *testing.T) {
+    config := &conf.AdvertiseConfig{
+        Burst:       3,
+        Interval:    15 * time.Second,
+        MaxInterval: 60 * time.Second,
+    }
+
+    schedule := newAnnouncementSchedule(config)
+
+    if delay := schedule.next(); delay < 0 || delay >= burstInterval {
+        t.Errorf("Initial delay %v is not between 0 and %v", delay, burstInterval)
+    }
+
+    expected := []time.Duration{
+        time.Second, time.Second,
+        15 * time.Second, 30 * time.Second, 60 * time.Second, 60 * time.Second,
+    }
+
+    for i, want := range expected {
+        if delay := schedule.next(); delay != want {
+            t.Errorf("Delay %v is %v instead of %v", i + 2, delay, want)
+        }
+    }
+
+    schedule.restart()
+
+    if delay := schedule.next(); delay != time.Second {
+        t.Errorf("Delay after restart is %v instead of %v", delay, time.Second)
+    }
+}
+
+func Test_AnnouncementScheduleJitter(t *testing.T) {
+    config := &conf.AdvertiseConfig{
+        Interval:    10 * time.Second,
+        MaxInterval: 10 * time.Second,
+        Jitter:      10,
+    }
+
+    schedule := newAnnouncementSchedule(config)
+    schedule.next()
+
+    for i := 0; i < 100; i++ {
+        if delay := schedule.next(); delay < 9 * time.Second || delay > 11 * time.Second {
+            t.Fatalf("Delay %v is not within 10 percent of %v", delay, config.Interval)
+        }
+    }
+}
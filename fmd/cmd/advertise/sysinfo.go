@@ -0,0 +1,103 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+package advertise
+
+import (
+    "runtime"
+    "runtime/debug"
+    "github.com/DennisSchulmeister/find-my-device/fmd/conf"
+    "github.com/DennisSchulmeister/find-my-device/fmd/msg"
+)
+
+// System details that are read in a platform specific way, see
+// readSystemDetails(). Values that cannot be read remain empty.
+type systemDetails struct {
+    KernelVersion string
+    OSRelease     string
+    HardwareModel string
+    CPUModel      string
+    MemoryTotal   uint64
+    Uptime        uint64
+    MachineID     string
+}
+
+// Add the optional system details to the device information, unless they
+// are suppressed by the configuration
+func addSystemDetails(information *msg.DeviceInformationMessage, config *conf.AdvertiseConfig) {
+    details := readSystemDetails()
+
+    if config.IncludeKernel {
+        information.KernelVersion = details.KernelVersion
+    }
+
+    if config.IncludeRelease {
+        information.OSRelease = details.OSRelease
+    }
+
+    if config.IncludeHardware {
+        information.HardwareModel = details.HardwareModel
+        information.Architecture  = runtime.GOARCH
+        information.CPUModel      = details.CPUModel
+        information.CPUCount      = runtime.NumCPU()
+        information.MemoryTotal   = details.MemoryTotal
+    }
+
+    if config.IncludeUptime {
+        information.Uptime = details.Uptime
+    }
+
+    if config.IncludeMachineID {
+        information.MachineID = details.MachineID
+    }
+
+    if config.IncludeVersion {
+        information.Version = fmdVersion()
+    }
+}
+
+// Get the fmd version: Either set at build time or taken from the build info.
+// For local builds the module version is "(devel)", in which case the VCS
+// revision is used, if available.
+func fmdVersion() string {
+    if conf.Version != "" {
+        return conf.Version
+    }
+
+    buildInfo, ok := debug.ReadBuildInfo()
+    if !ok { return "" }
+
+    if buildInfo.Main.Version != "" && buildInfo.Main.Version != "(devel)" {
+        return buildInfo.Main.Version
+    }
+
+    revision, modified := "", false
+
+    for _, setting := range buildInfo.Settings {
+        switch setting.Key {
+            case "vcs.revision":
+                revision = setting.Value
+            case "vcs.modified":
+                modified = setting.Value == "true"
+        }
+    }
+
+    if revision == "" {
+        return buildInfo.Main.Version
+    }
+
+    if len(revision) > 12 {
+        revision = revision[:12]
+    }
+
+    if modified {
+        revision += "-dirty"
+    }
+
+    return "devel-" + revision
+}
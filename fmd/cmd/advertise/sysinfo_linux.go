@@ -0,0 +1,140 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+//go:build linux
+
+package advertise
+
+import (
+    "bufio"
+    "os"
+    "strconv"
+    "strings"
+)
+
+// Read system details from /proc, /sys and /etc
+func readSystemDetails() systemDetails {
+    return systemDetails{
+        KernelVersion: readFirstLine("/proc/sys/kernel/osrelease"),
+        OSRelease:     parseOSRelease(readFirstFile("/etc/os-release", "/usr/lib/os-release")),
+        HardwareModel: readHardwareModel(),
+        CPUModel:      parseCPUModel(readFirstFile("/proc/cpuinfo")),
+        MemoryTotal:   parseMemoryTotal(readFirstFile("/proc/meminfo")),
+        Uptime:        parseUptime(readFirstLine("/proc/uptime")),
+        MachineID:     readFirstLine("/etc/machine-id", "/var/lib/dbus/machine-id"),
+    }
+}
+
+// Read the content of the first existing file. Returns an empty string if
+// none of the files can be read.
+func readFirstFile(paths ...string) string {
+    for _, path := range paths {
+        data, err := os.ReadFile(path)
+        if err == nil { return string(data) }
+    }
+
+    return ""
+}
+
+// Read the first line of the first existing file without surrounding
+// whitespace and trailing null bytes, as found in the device tree
+func readFirstLine(paths ...string) string {
+    line, _, _ := strings.Cut(readFirstFile(paths...), "\n")
+    return strings.TrimSpace(strings.TrimRight(line, "\x00"))
+}
+
+// Get the hardware model from the device tree (e.g. Raspberry Pi) or from
+// the DMI information of PCs and servers
+func readHardwareModel() string {
+    if model := readFirstLine("/sys/firmware/devicetree/base/model"); model != "" {
+        return model
+    }
+
+    vendor  := readFirstLine("/sys/class/dmi/id/sys_vendor")
+    product := readFirstLine("/sys/class/dmi/id/product_name")
+    return strings.TrimSpace(vendor + " " + product)
+}
+
+// Get the pretty name from the content of /etc/os-release, falling back to
+// the name and version
+func parseOSRelease(data string) string {
+    values := make(map[string]string)
+
+    for _, line := range strings.Split(data, "\n") {
+        key, value, found := strings.Cut(strings.TrimSpace(line), "=")
+        if !found || strings.HasPrefix(key, "#") { continue }
+
+        if unquoted, err := strconv.Unquote(value); err == nil {
+            value = unquoted
+        } else {
+            value = strings.Trim(value, "'")
+        }
+
+        values[key] = value
+    }
+
+    if values["PRETTY_NAME"] != "" {
+        return values["PRETTY_NAME"]
+    }
+
+    return strings.TrimSpace(values["NAME"] + " " + values["VERSION"])
+}
+
+// Get the CPU model from the content of /proc/cpuinfo. The key differs
+// between x86 ("model name") and ARM kernels ("Hardware" with the SoC, e.g.
+// BCM2835). The "Model" key of ARM is the board, see readHardwareModel().
+func parseCPUModel(data string) string {
+    values  := make(map[string]string)
+    scanner := bufio.NewScanner(strings.NewReader(data))
+
+    for scanner.Scan() {
+        key, value, found := strings.Cut(scanner.Text(), ":")
+        if !found { continue }
+
+        key = strings.TrimSpace(key)
+
+        if _, exists := values[key]; !exists {
+            values[key] = strings.TrimSpace(value)
+        }
+    }
+
+    for _, key := range []string{"model name", "cpu model", "Hardware", "cpu"} {
+        if values[key] != "" { return values[key] }
+    }
+
+    return ""
+}
+
+// Get the total memory in bytes from the content of /proc/meminfo
+func parseMemoryTotal(data string) uint64 {
+    for _, line := range strings.Split(data, "\n") {
+        key, value, found := strings.Cut(line, ":")
+        if !found || key != "MemTotal" { continue }
+
+        fields := strings.Fields(value)
+        if len(fields) == 0 { return 0 }
+
+        kiloBytes, err := strconv.ParseUint(fields[0], 10, 64)
+        if err != nil { return 0 }
+
+        return kiloBytes * 1024
+    }
+
+    return 0
+}
+
+// Get the uptime in seconds from the content of /proc/uptime
+func parseUptime(line string) uint64 {
+    fields := strings.Fields(line)
+    if len(fields) == 0 { return 0 }
+
+    seconds, err := strconv.ParseFloat(fields[0], 64)
+    if err != nil || seconds < 0 { return 0 }
+
+    return uint64(seconds)
+}
@@ -0,0 +1,49 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+//go:build linux
+
+package advertise
+
+import (
+    "testing"
+)
+
+func Test_ParseSystemDetails(t *testing.T) {
+    osRelease := "NAME=\"Debian GNU/Linux\"\nVERSION=\"12 (bookworm)\"\nPRETTY_NAME=\"Debian GNU/Linux 12 (bookworm)\"\n"
+
+    if result := parseOSRelease(osRelease); result != "Debian GNU/Linux 12 (bookworm)" {
+        t.Errorf("parseOSRelease() returned %q", result)
+    }
+
+    if result := parseOSRelease("NAME='Alpine Linux'\nVERSION=3.18\n"); result != "Alpine Linux 3.18" {
+        t.Errorf("parseOSRelease() without PRETTY_NAME returned %q", result)
+    }
+
+    cpuInfo := "processor\t: 0\nmodel name\t: Intel(R) Xeon(R) Processor\n\nprocessor\t: 1\nmodel name\t: Intel(R) Xeon(R) Processor\n"
+
+    if result := parseCPUModel(cpuInfo); result != "Intel(R) Xeon(R) Processor" {
+        t.Errorf("parseCPUModel() returned %q", result)
+    }
+
+    if result := parseCPUModel("processor\t: 0\nBogoMIPS\t: 108.00\n\nHardware\t: BCM2835\nModel\t\t: Raspberry Pi 4 Model B Rev 1.4\n"); result != "BCM2835" {
+        t.Errorf("parseCPUModel() for ARM returned %q", result)
+    }
+
+    if result := parseMemoryTotal("MemTotal:        6158152 kB\nMemFree:  1000 kB\n"); result != 6158152 * 1024 {
+        t.Errorf("parseMemoryTotal() returned %v", result)
+    }
+
+    if result := parseUptime("2459.06 2126.24"); result != 2459 {
+        t.Errorf("parseUptime() returned %v", result)
+    }
+
+    if result := parseUptime(""); result != 0 {
+        t.Errorf("parseUptime() for empty input returned %v", result)
+    }
+}
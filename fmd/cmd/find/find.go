@@ -9,22 +9,57 @@
 package find
 
 import (
+    "context"
+    "encoding/json"
     "fmt"
+    "net"
+    "sort"
+    "strings"
+    "time"
     "github.com/DennisSchulmeister/find-my-device/fmd/app"
     "github.com/DennisSchulmeister/find-my-device/fmd/conf"
+    "github.com/DennisSchulmeister/find-my-device/fmd/msg"
+    "github.com/DennisSchulmeister/find-my-device/fmd/str"
 )
 
 // Command "find": Try to find a device on the local network
 type FindCommandStruct struct {
-    app.Command
+    app.CommandStruct
+
+    app    app.App
     config *conf.Config
 }
 
+// Device found on the local network
+type foundDevice struct {
+    Group           string
+    DeviceName      string
+    HostName        string
+    OperatingSystem string
+    Addresses       []string
+
+    // Optional details, if sent by the device
+    KernelVersion   string `json:",omitempty"`
+    OSRelease       string `json:",omitempty"`
+    HardwareModel   string `json:",omitempty"`
+    Architecture    string `json:",omitempty"`
+    CPUModel        string `json:",omitempty"`
+    CPUCount        int    `json:",omitempty"`
+    MemoryTotal     uint64 `json:",omitempty"`
+    Uptime          uint64 `json:",omitempty"`
+    MachineID       string `json:",omitempty"`
+    Version         string `json:",omitempty"`
+}
+
 // Create new command instance
 func New(config *conf.Config) app.Command {
-    return &FindCommandStruct{
+    this := &FindCommandStruct{
         config: config,
     }
+
+    this.CommandStruct.Steps = this
+    this.CommandStruct.StopTimeout = &config.General.StopTimeout
+    return this
 }
 
 // Provide help information
@@ -32,13 +67,219 @@ func (this *FindCommandStruct) Help() *app.CommandHelp {
     return &app.CommandHelp{
         Description: "Find devices on the local network or remote registry server",
         Help: `
-            TODO: Help for find command
+            Sends a request to all devices on the local network and prints the
+            devices that answer within --wait seconds, together with their network
+            addresses. The search can be restricted to a group of devices with
+            --group and to a comma-separated list of device or host names with
+            --device-name, e.g.:
+
+                $program$ $command$ --device-name kitchen-pi,garage-pi
+
+            With --json the devices are printed as a single JSON array without
+            startup banner. It contains further details like kernel version,
+            hardware, memory, uptime and fmd version, as far as the devices send
+            them.
+
+            Only devices running '$program$ advertise' can be found.
         `,
     }
 }
 
-// Run the command
-func (this *FindCommandStruct) Run(app app.App) error {
-    fmt.Println("TODO: Find")
+// Set app instance
+func (this *FindCommandStruct) App(app app.App) {
+    this.app = app
+}
+
+// Return title and configuration values for the startup banner. With --json
+// no banner is printed, so that the result is a single JSON document.
+func (this *FindCommandStruct) Header() *app.CommandHeader {
+    return &app.CommandHeader{
+        Title: "Find devices",
+        Quiet: this.config.General.Quiet || this.config.General.JSON,
+        JSON:  this.config.General.JSON,
+        Values: []any{
+            &this.config.General.MulticastIP4,
+            &this.config.General.MulticastIP6,
+            &this.config.General.Port,
+            &this.config.General.Encoding,
+            &this.config.Find.Local,
+            &this.config.Find.Group,
+            &this.config.Find.DeviceName,
+            &this.config.Find.Wait,
+        },
+    }
+}
+
+// Check configuration values
+func (this *FindCommandStruct) Validate() error {
+    if this.config.Find.Registry {
+        err := this.app.Configuration().Require(this.config.General.Interactive,
+            &this.config.General.Username, &this.config.General.Password, &this.config.Find.SecretKey)
+        if err != nil { return err }
+    }
+
+    if this.config.Find.Local {
+        return msg.ValidateConfig(this.config)
+    }
+
     return nil
 }
+
+// Return go-routines to be started
+func (this *FindCommandStruct) Go() []app.CommandFunc {
+    functions := make([]app.CommandFunc, 0)
+
+    if this.config.Find.Local {
+        functions = append(functions, this.findLocalDevices)
+    }
+
+    return functions
+}
+
+// Send find request on the local network and print the answering devices
+func (this *FindCommandStruct) findLocalDevices(ctx context.Context) error {
+    // Create network connections
+    conns, err := msg.DialMulticast(this.config)
+    if err != nil { return err }
+    defer conns.Close()
+
+    conns.Start()
+
+    // Send request and collect answers until timeout
+    request := msg.NewDeviceInformationRequest(this.config.Find.Group, this.deviceNames())
+    request.Header.Flags = msg.EncodingFlags(this.config.General.Encoding)
+    responses, err := msg.Query(ctx, conns, request, time.Now().Add(this.config.Find.Wait))
+
+    if ctx.Err() != nil {
+        return nil
+    } else if err != nil {
+        return err
+    }
+
+    devices := make([]*foundDevice, 0)
+
+    for _, response := range responses {
+        if device := this.newFoundDevice(request.ClientRequest, response); device != nil {
+            devices = append(devices, device)
+        }
+    }
+
+    return this.printDevices(devices)
+}
+
+// Get the searched device names from the comma-separated list
+func (this *FindCommandStruct) deviceNames() []string {
+    deviceNames := make([]string, 0)
+
+    for _, deviceName := range strings.Split(this.config.Find.DeviceName, ",") {
+        deviceName = strings.TrimSpace(deviceName)
+
+        if deviceName != "" {
+            deviceNames = append(deviceNames, deviceName)
+        }
+    }
+
+    return deviceNames
+}
+
+// Create found device from a received answer, if it matches the search
+// criteria. Returns nil otherwise.
+func (this *FindCommandStruct) newFoundDevice(request *msg.ClientRequestMessage, response msg.Response) *foundDevice {
+    information := response.Message.DeviceInformation
+    if information == nil { return nil }
+
+    if !request.Matches(information.Group, information.DeviceName, information.HostName) {
+        return nil
+    }
+
+    device := &foundDevice{
+        Group:           information.Group,
+        DeviceName:      information.DeviceName,
+        HostName:        information.HostName,
+        OperatingSystem: information.OperatingSystem,
+        Addresses:       make([]string, 0),
+        KernelVersion:   information.KernelVersion,
+        OSRelease:       information.OSRelease,
+        HardwareModel:   information.HardwareModel,
+        Architecture:    information.Architecture,
+        CPUModel:        information.CPUModel,
+        CPUCount:        information.CPUCount,
+        MemoryTotal:     information.MemoryTotal,
+        Uptime:          information.Uptime,
+        MachineID:       information.MachineID,
+        Version:         information.Version,
+    }
+
+    addresses := make([]string, 0)
+
+    for _, networkInterface := range information.NetworkInterfaces {
+        if networkInterface.Flags & net.FlagLoopback != 0 { continue }
+
+        for _, address := range networkInterface.Addresses {
+            addresses = append(addresses, address.Address)
+        }
+    }
+
+    for _, sender := range response.Addresses {
+        if udpAddr, ok := sender.(*net.UDPAddr); ok {
+            addresses = append(addresses, udpAddr.IP.String())
+        }
+    }
+
+    for _, address := range addresses {
+        if !containsAddress(device.Addresses, address) {
+            device.Addresses = append(device.Addresses, address)
+        }
+    }
+
+    return device
+}
+
+// Check, whether the list contains the address with or without network prefix
+func containsAddress(addresses []string, address string) bool {
+    ip, _, _ := strings.Cut(address, "/")
+
+    for _, existing := range addresses {
+        existingIP, _, _ := strings.Cut(existing, "/")
+        if existingIP == ip { return true }
+    }
+
+    return false
+}
+
+// Print the found devices as table or JSON, sorted by their names
+func (this *FindCommandStruct) printDevices(devices []*foundDevice) error {
+    sort.SliceStable(devices, func(i, j int) bool {
+        return devices[i].sortKey() < devices[j].sortKey()
+    })
+
+    if this.config.General.JSON {
+        data, err := json.Marshal(devices)
+        if err != nil { return err }
+
+        fmt.Println(string(data))
+        return nil
+    }
+
+    if len(devices) == 0 {
+        fmt.Println("No devices found")
+        return nil
+    }
+
+    table := str.NewTable("Device", "Host", "Group", "OS", "Addresses")
+
+    for _, device := range devices {
+        operatingSystem := device.OperatingSystem
+        if device.OSRelease != "" { operatingSystem = device.OSRelease }
+
+        table.AddRow(device.DeviceName, device.HostName, device.Group, operatingSystem, strings.Join(device.Addresses, ", "))
+    }
+
+    fmt.Print(table.String())
+    return nil
+}
+
+// Key to sort the found devices
+func (this *foundDevice) sortKey() string {
+    return this.Group + "/" + this.DeviceName + "/" + this.HostName
+}
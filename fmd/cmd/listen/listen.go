@@ -9,23 +9,60 @@
 package listen
 
 import (
+    "context"
+    "errors"
+    "encoding/json"
     "fmt"
+    "log"
+    "sort"
+    "time"
     "github.com/DennisSchulmeister/find-my-device/fmd/app"
     "github.com/DennisSchulmeister/find-my-device/fmd/conf"
+    "github.com/DennisSchulmeister/find-my-device/fmd/msg"
+    "github.com/DennisSchulmeister/find-my-device/fmd/str"
 )
 
 // Command "listen": Listen for device announcements on the local network and log
 // them on the console.
 type ListenCommandStruct struct {
-    app.Command
+    app.CommandStruct
+
+    app    app.App
     config *conf.Config
 }
 
+// Device seen on the local network
+type seenDevice struct {
+    Group      string
+    DeviceName string
+    HostName   string
+    Address    string
+    Interface  string
+    FirstSeen  time.Time
+    LastSeen   time.Time
+    Gone       bool
+}
+
+// Log entry for JSON output
+type logEntry struct {
+    Time       time.Time
+    Event      string
+    Address    string
+    Interface  string
+    Group      string
+    DeviceName string
+    HostName   string
+}
+
 // Create new command instance
 func New(config *conf.Config) app.Command {
-    return &ListenCommandStruct{
+    this := &ListenCommandStruct{
         config: config,
     }
+
+    this.CommandStruct.Steps = this
+    this.CommandStruct.StopTimeout = &config.General.StopTimeout
+    return this
 }
 
 // Provide help information
@@ -33,13 +70,251 @@ func (this *ListenCommandStruct) Help() *app.CommandHelp {
     return &app.CommandHelp{
         Description: "Listen for device announcements on the local network",
         Help: `
-            TODO: Help for listen command
+            Joins the multicast groups and logs each device announcement with the
+            sender address, group, device and host name. Devices that say goodbye
+            on shutdown or don't send an announcement for --expire seconds are
+            reported as gone. On exit a summary of all seen devices is printed.
+
+            By default the command runs until interrupted with Ctrl+C. Use --timeout
+            to stop after the given number of seconds. With --json each event is
+            logged as a single line of JSON.
         `,
     }
 }
 
-// Run the command
-func (this *ListenCommandStruct) Run(app app.App) error {
-    fmt.Println("TODO: Listen")
+// Set app instance
+func (this *ListenCommandStruct) App(app app.App) {
+    this.app = app
+}
+
+// Return title and configuration values for the startup banner
+func (this *ListenCommandStruct) Header() *app.CommandHeader {
+    return &app.CommandHeader{
+        Title: "Listen for device announcements",
+        Quiet: this.config.General.Quiet,
+        JSON:  this.config.General.JSON,
+        Values: []any{
+            &this.config.General.MulticastIP4,
+            &this.config.General.MulticastIP6,
+            &this.config.General.Port,
+            &this.config.Listen.Timeout,
+            &this.config.Listen.Expire,
+        },
+    }
+}
+
+// Check configuration values
+func (this *ListenCommandStruct) Validate() error {
+    return msg.ValidateConfig(this.config)
+}
+
+// Return go-routines to be started
+func (this *ListenCommandStruct) Go() []app.CommandFunc {
+    return []app.CommandFunc{this.listenForAnnouncements}
+}
+
+// Log device announcements until interrupted or timed out
+func (this *ListenCommandStruct) listenForAnnouncements(ctx context.Context) error {
+    // Create network connections
+    conns, err := msg.ListenMulticast(this.config)
+    if err != nil { return err }
+    defer conns.Close()
+
+    for _, conn := range conns.Connections() {
+        log.Printf("Listening for announcements on %v", conns.RemoteAddr(conn))
+    }
+
+    conns.Start()
+
+    // Log received announcements
+    coder   := msg.NewMessageCoder()
+    devices := make(map[string]*seenDevice)
+
+    var timeout <-chan time.Time
+
+    if this.config.Listen.Timeout > 0 {
+        timeout = time.After(this.config.Listen.Timeout)
+    }
+
+    var expire <-chan time.Time
+
+    if this.config.Listen.Expire > 0 {
+        ticker := time.NewTicker(time.Second)
+        defer ticker.Stop()
+        expire = ticker.C
+    }
+
+    for {
+        select {
+            case <- ctx.Done():
+                return this.printSummary(devices)
+
+            case <- timeout:
+                return this.printSummary(devices)
+
+            case now := <- expire:
+                this.expireDevices(devices, now)
+
+            case datagram := <- conns.Read():
+                if datagram.Error != nil {
+                    log.Printf("%v", datagram.Error)
+                    continue
+                }
+
+                message, err := coder.Decode(datagram.Data)
+
+                if errors.Is(err, msg.ErrNotFMD) || errors.Is(err, msg.ErrIncomplete) {
+                    continue
+                } else if err != nil {
+                    log.Printf("Ignoring datagram from %v: %v", datagram.Address, err)
+                    continue
+                }
+
+                if message.DeviceAdvertisement != nil {
+                    this.addAdvertisement(devices, message.DeviceAdvertisement, datagram)
+                }
+
+                if message.DeviceInformation != nil {
+                    information := message.DeviceInformation
+
+                    this.addAdvertisement(devices, &msg.DeviceAdvertisementMessage{
+                        Group:      information.Group,
+                        DeviceName: information.DeviceName,
+                        HostName:   information.HostName,
+                    }, datagram)
+                }
+
+                if message.DeviceGoodbye != nil {
+                    this.addGoodbye(devices, message.DeviceGoodbye, datagram)
+                }
+        }
+    }
+}
+
+// Log device advertisement and remember when the device has been seen
+func (this *ListenCommandStruct) addAdvertisement(devices map[string]*seenDevice, advertisement *msg.DeviceAdvertisementMessage, datagram msg.Datagram) {
+    now := datagram.Time
+    key := advertisement.Group + "/" + advertisement.DeviceName + "/" + advertisement.HostName
+    device, found := devices[key]
+
+    if !found {
+        device = &seenDevice{
+            Group:      advertisement.Group,
+            DeviceName: advertisement.DeviceName,
+            HostName:   advertisement.HostName,
+            FirstSeen:  now,
+        }
+
+        devices[key] = device
+    } else if device.Gone {
+        device.Gone = false
+        this.logEvent("back", device)
+    }
+
+    device.Address   = datagram.Address.String()
+    device.Interface = datagram.Interface
+    device.LastSeen  = now
+    this.logEvent("advertisement", device)
+}
+
+// Log device goodbye and mark the device as gone
+func (this *ListenCommandStruct) addGoodbye(devices map[string]*seenDevice, goodbye *msg.DeviceGoodbyeMessage, datagram msg.Datagram) {
+    key := goodbye.Group + "/" + goodbye.DeviceName + "/" + goodbye.HostName
+    device, found := devices[key]
+
+    if !found {
+        device = &seenDevice{
+            Group:      goodbye.Group,
+            DeviceName: goodbye.DeviceName,
+            HostName:   goodbye.HostName,
+            FirstSeen:  datagram.Time,
+        }
+
+        devices[key] = device
+    } else if device.Gone {
+        // Same goodbye received via IPv4 and IPv6
+        return
+    }
+
+    device.Address   = datagram.Address.String()
+    device.Interface = datagram.Interface
+    device.LastSeen  = datagram.Time
+    device.Gone      = true
+    this.logEvent("goodbye", device)
+}
+
+// Report devices that haven't been seen for the configured time
+func (this *ListenCommandStruct) expireDevices(devices map[string]*seenDevice, now time.Time) {
+    for _, device := range devices {
+        if device.Gone || now.Sub(device.LastSeen) < this.config.Listen.Expire {
+            continue
+        }
+
+        device.Gone = true
+        this.logEvent("gone", device)
+    }
+}
+
+// Log event for a device, either as text or JSON
+func (this *ListenCommandStruct) logEvent(event string, device *seenDevice) {
+    if this.config.General.JSON {
+        data, err := json.Marshal(logEntry{
+            Time:       time.Now(),
+            Event:      event,
+            Address:    device.Address,
+            Interface:  device.Interface,
+            Group:      device.Group,
+            DeviceName: device.DeviceName,
+            HostName:   device.HostName,
+        })
+
+        if err == nil {
+            fmt.Println(string(data))
+        }
+
+        return
+    }
+
+    switch event {
+        case "gone":
+            log.Printf("Device stopped advertising: %v (host %v, group %v), last seen %v from %v",
+                device.DeviceName, device.HostName, device.Group, device.LastSeen.Format("15:04:05"), device.Address)
+        case "goodbye":
+            log.Printf("Device said goodbye: %v (host %v, group %v) from %v", device.DeviceName, device.HostName, device.Group, device.Address)
+        case "back":
+            log.Printf("Device is advertising again: %v (host %v, group %v)", device.DeviceName, device.HostName, device.Group)
+        default:
+            log.Printf("Advertisement from %v on %v: device %v, host %v, group %v", device.Address, device.Interface, device.DeviceName, device.HostName, device.Group)
+    }
+}
+
+// Print all seen devices with first and last time seen
+func (this *ListenCommandStruct) printSummary(devices map[string]*seenDevice) error {
+    if this.config.General.JSON || len(devices) == 0 {
+        return nil
+    }
+
+    list := make([]*seenDevice, 0, len(devices))
+
+    for _, device := range devices {
+        list = append(list, device)
+    }
+
+    sort.Slice(list, func(i, j int) bool {
+        return list[i].FirstSeen.Before(list[j].FirstSeen)
+    })
+
+    table := str.NewTable("Device", "Host", "Group", "Address", "Interface", "First seen", "Last seen", "Status")
+
+    for _, device := range list {
+        status := "active"
+        if device.Gone { status = "gone" }
+
+        table.AddRow(device.DeviceName, device.HostName, device.Group, device.Address, device.Interface,
+            device.FirstSeen.Format("2006-01-02 15:04:05"), device.LastSeen.Format("2006-01-02 15:04:05"), status)
+    }
+
+    fmt.Println()
+    fmt.Print(table.String())
     return nil
 }
@@ -0,0 +1,117 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+package listen
+
+import (
+    "bytes"
+    "log"
+    "net"
+    "os"
+    "strings"
+    "testing"
+    "time"
+    "github.com/DennisSchulmeister/find-my-device/fmd/conf"
+    "github.com/DennisSchulmeister/find-my-device/fmd/msg"
+)
+
+// Capture the log output of the test
+func captureLog(t *testing.T) *bytes.Buffer {
+    buffer := &bytes.Buffer{}
+    log.SetOutput(buffer)
+    t.Cleanup(func() { log.SetOutput(os.Stderr) })
+    return buffer
+}
+
+// Create datagram as received from the given IP address
+func newTestDatagram(ip string, now time.Time) msg.Datagram {
+    return msg.Datagram{
+        Address:   &net.UDPAddr{IP: net.ParseIP(ip), Port: 54321},
+        Interface: "eth0",
+        Time:      now,
+    }
+}
+
+func Test_GoodbyeReceivedTwice(t *testing.T) {
+    output  := captureLog(t)
+    command := New(&conf.Config{}).(*ListenCommandStruct)
+    devices := make(map[string]*seenDevice)
+    now     := time.Now()
+
+    advertisement := &msg.DeviceAdvertisementMessage{Group: "home", DeviceName: "kitchen-pi", HostName: "pi"}
+    goodbye := &msg.DeviceGoodbyeMessage{Group: "home", DeviceName: "kitchen-pi", HostName: "pi"}
+
+    command.addAdvertisement(devices, advertisement, newTestDatagram("192.0.2.2", now))
+    command.addGoodbye(devices, goodbye, newTestDatagram("192.0.2.2", now))
+    command.addGoodbye(devices, goodbye, newTestDatagram("fe80::1", now))
+
+    if len(devices) != 1 {
+        t.Fatalf("%v devices seen instead of one", len(devices))
+    }
+
+    for _, device := range devices {
+        if !device.Gone {
+            t.Errorf("Device is not gone after goodbye")
+        }
+
+        if device.Address != "192.0.2.2:54321" {
+            t.Errorf("Duplicate goodbye changed the address to %v", device.Address)
+        }
+    }
+
+    if count := strings.Count(output.String(), "Device said goodbye"); count != 1 {
+        t.Errorf("Goodbye logged %v times instead of once:\n%v", count, output)
+    }
+}
+
+func Test_DeviceGoneAndBack(t *testing.T) {
+    output := captureLog(t)
+    config := &conf.Config{}
+    config.Listen.Expire = time.Minute
+
+    command := New(config).(*ListenCommandStruct)
+    devices := make(map[string]*seenDevice)
+    now     := time.Now()
+
+    advertisement := &msg.DeviceAdvertisementMessage{Group: "home", DeviceName: "kitchen-pi", HostName: "pi"}
+    command.addAdvertisement(devices, advertisement, newTestDatagram("192.0.2.2", now))
+    device := devices["home/kitchen-pi/pi"]
+
+    command.expireDevices(devices, now.Add(30 * time.Second))
+
+    if device.Gone {
+        t.Fatalf("Device expired before --expire")
+    }
+
+    command.expireDevices(devices, now.Add(2 * time.Minute))
+    command.expireDevices(devices, now.Add(3 * time.Minute))
+
+    if !device.Gone {
+        t.Fatalf("Device did not expire after --expire")
+    }
+
+    command.addAdvertisement(devices, advertisement, newTestDatagram("192.0.2.2", now.Add(4 * time.Minute)))
+
+    if device.Gone {
+        t.Errorf("Device is still gone after a new advertisement")
+    }
+
+    if !device.FirstSeen.Equal(now) || !device.LastSeen.Equal(now.Add(4 * time.Minute)) {
+        t.Errorf("Wrong first or last seen time: %v, %v", device.FirstSeen, device.LastSeen)
+    }
+
+    text := output.String()
+
+    if count := strings.Count(text, "Device stopped advertising"); count != 1 {
+        t.Errorf("Gone device logged %v times instead of once:\n%v", count, text)
+    }
+
+    if count := strings.Count(text, "Device is advertising again"); count != 1 {
+        t.Errorf("Returning device logged %v times instead of once:\n%v", count, text)
+    }
+}
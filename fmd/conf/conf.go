@@ -12,60 +12,83 @@ import "time"
 
 // Definition of the central program configuration.
 // Used to read flags, env variables and config files.
+//
+// Each section carries the prefix of its environment variables and the
+// command it belongs to (empty for general values). Each value carries its
+// default value, whether it must be hidden from the user and a help text.
+// Duration values are given in seconds unless a unit like "1m" is given.
 type Config struct {
-    General   GeneralConfig   `prefix: "FMD_"           command: ""`
-    Advertise AdvertiseConfig `prefix: "FMD_ADVERTISE_" command: "advertise"`
-    Find      FindConfig      `prefix: "FMD_FIND_"      command: "find"`
-    Listen    ListenConfig    `prefix: "FMD_LISTEN_"    command: "listen"`
-    Remote    RemoteConfig    `prefix: "FMD_REMOTE_"    command: "remote"`
-    Registry  RegistryConfig  `prefix: "FMD_REGISTRY_"  command: "registry"`
+    General   GeneralConfig   `prefix:"FMD_"           command:""`
+    Advertise AdvertiseConfig `prefix:"FMD_ADVERTISE_" command:"advertise"`
+    Find      FindConfig      `prefix:"FMD_FIND_"      command:"find"`
+    Listen    ListenConfig    `prefix:"FMD_LISTEN_"    command:"listen"`
+    Remote    RemoteConfig    `prefix:"FMD_REMOTE_"    command:"remote"`
+    Registry  RegistryConfig  `prefix:"FMD_REGISTRY_"  command:"registry"`
 }
 
 // General configuration values for all commands.
 // NOTE: Field names must not conflict with fields in the other structures!
 type GeneralConfig struct {
-    MulticastIP4 string         `default: "224.0.0.1"   hide: "false"   help: "IPv4 multicast address for local network communication"`
-    MulticastIP6 string         `default: "ff02::1"     hide: "false"   help: "IPv6 multicast address for local network communication"`
-    InterfaceIP6 string         `default: ""            hide: ""        help: "Comma-separated list of network devices for IPv6 multicast"`
-    Port         uint32         `default: "54321"       hide: "false"   help: "UDP port for local network communication"`
-    URL          string         `default: "https://find-my-device.iot-embedded.de"  hide: "false"   help: "URL of remote registry server"`
-    Username     string         `default: ""            hide: "false"   help: "Username to authenticate at the remote registry server"`
-    Password     string         `default: ""            hide: "true"    help: "Password to authenticate at the remote registry server"`
-    Interactive  bool           `default: "true"        hide: "false"   help: "Ask user to enter missing values interactively"`
+    MulticastIP4 string         `default:"224.0.0.1"   hide:"false"   help:"IPv4 multicast address for local network communication"`
+    MulticastIP6 string         `default:"ff02::1"     hide:"false"   help:"IPv6 multicast address for local network communication"`
+    InterfaceIP4 string         `default:""            hide:"false"   help:"Network devices for IPv4 multicast, e.g. \"eth*,!docker*\" (default: all)"`
+    InterfaceIP6 string         `default:""            hide:"false"   help:"Network devices for IPv6 multicast, e.g. \"eth*,!docker*\" (default: all)"`
+    Port         uint32         `default:"54321"       hide:"false"   help:"UDP port for local network communication"`
+    MulticastTTL uint32         `default:"1"           hide:"false"   help:"Time-to-live (IPv4) or hop limit (IPv6) of multicast datagrams"`
+    Encoding     string         `default:"json"        hide:"false"   help:"Message encoding on the local network: json or the more compact cbor"`
+    URL          string         `default:"https://find-my-device.iot-embedded.de"  hide:"false"   help:"URL of remote registry server"`
+    Username     string         `default:""            hide:"false"   help:"Username to authenticate at the remote registry server"`
+    Password     string         `default:""            hide:"true"    help:"Password to authenticate at the remote registry server"`
+    Interactive  bool           `default:"true"        hide:"false"   help:"Ask user to enter missing values interactively"`
+    Quiet        bool           `default:"false"       hide:"false"   help:"Don't print the startup banner with the configuration"`
+    JSON         bool           `default:"false"       hide:"false"   help:"Print JSON instead of text, e.g. the banner and events for log collectors"`
+    StopTimeout  time.Duration  `default:"5"           hide:"false"   help:"Seconds to wait for running tasks to stop on shutdown"`
 }
 
 type AdvertiseConfig struct {
-    Respond      bool           `default: "true"        hide: "false"   help: "Respond to find requests on the local network"`
-    Multicast    bool           `default: "true"        hide: "false"   help: "Send device announcements on the local network"`
-    Registry     bool           `default: "true"        hide: "false"   help: "Advertise device information on remote registry server"`
-    Interval     time.Duration  `default: "15"          hide: "false"   help: "Seconds between advertisements"`
-    Group        string         `default: ""            hide: "false"   help: "Optional name to group related devices"`
-    DeviceName   string         `default: ""            hide: "false"   help: "Name of the device if not the system hostname"`
-    SecretKey    string         `default: ""            hide: "true"    help: "Secret key to encrypt and restrict access to device information"`
-    AuthKey      string         `default: ""            hide: "true"    help: "Owner authorization key in the remote registry"`
+    Respond          bool           `default:"true"        hide:"false"   help:"Respond to find requests on the local network"`
+    Multicast        bool           `default:"true"        hide:"false"   help:"Send device announcements on the local network"`
+    Registry         bool           `default:"false"       hide:"false"   help:"Advertise device information on remote registry server"`
+    Burst            uint32         `default:"3"           hide:"false"   help:"Number of quick advertisements on startup and after address changes"`
+    Interval         time.Duration  `default:"15"          hide:"false"   help:"Seconds between advertisements after the startup burst"`
+    MaxInterval      time.Duration  `default:"60"          hide:"false"   help:"Maximum seconds between advertisements, the interval doubles up to this"`
+    Jitter           uint32         `default:"10"          hide:"false"   help:"Random variation of the advertisement intervals in percent"`
+    Group            string         `default:""            hide:"false"   help:"Optional name to group related devices"`
+    DeviceName       string         `default:""            hide:"false"   help:"Name of the device if not the system hostname"`
+    IncludeKernel    bool           `default:"true"        hide:"false"   help:"Include the kernel version in the device information"`
+    IncludeRelease   bool           `default:"true"        hide:"false"   help:"Include the OS release, e.g. \"Debian GNU/Linux 12\", in the device information"`
+    IncludeHardware  bool           `default:"true"        hide:"false"   help:"Include hardware model, CPU, architecture and memory in the device information"`
+    IncludeUptime    bool           `default:"true"        hide:"false"   help:"Include the system uptime in the device information"`
+    IncludeMachineID bool           `default:"false"       hide:"false"   help:"Include the unique machine ID in the device information"`
+    IncludeVersion   bool           `default:"true"        hide:"false"   help:"Include the fmd version in the device information"`
+    SecretKey        string         `default:""            hide:"true"    help:"Secret key to encrypt and restrict access to device information"`
+    AuthKey          string         `default:""            hide:"true"    help:"Owner authorization key in the remote registry"`
 }
 
 type FindConfig struct {
-    Local        bool           `default: "true"        hide: "false"   help: "Find devices on the local network"`
-    Registry     bool           `default: "true"        hide: "false"   help: "Find devices on remote registry server"`
-    DeviceName   bool           `default: ""            hide: "false"   help: "Comma-separated list of searched devices"`
-    SecretKey    bool           `default: ""            hide: "true"    help: "Secret key to access the device information"`
+    Local        bool           `default:"true"        hide:"false"   help:"Find devices on the local network"`
+    Registry     bool           `default:"false"       hide:"false"   help:"Find devices on remote registry server"`
+    DeviceName   string         `default:""            hide:"false"   help:"Comma-separated list of searched devices"`
+    Group        string         `default:""            hide:"false"   help:"Only find devices of this group"`
+    Wait         time.Duration  `default:"3"           hide:"false"   help:"Seconds to wait for answers from the devices"`
+    SecretKey    string         `default:""            hide:"true"    help:"Secret key to access the device information"`
 }
 
 type ListenConfig struct {
-    Timeout      time.Duration  `default: "0"           hide: "false"   help: "Maximum number of seconds to listen"`
+    Timeout      time.Duration  `default:"0"           hide:"false"   help:"Maximum number of seconds to listen"`
+    Expire       time.Duration  `default:"180"         hide:"false"   help:"Seconds after which silent devices are reported as gone"`
 }
 
 type RemoteConfig struct {
-    Request      string         `default: ""            hide: "false"   help: "Remote request. See help text for allowed values."`
-    Value        string         `default: ""            hide: "false"   help: "Parameter value for a remote request. See help text for details."`
+    Request      string         `default:""            hide:"false"   help:"Remote request. See help text for allowed values."`
+    Value        string         `default:""            hide:"false"   help:"Parameter value for a remote request. See help text for details."`
 }
 
 type RegistryConfig struct {
-    UI           bool           `default: "true"        hide: "false"   help: "Serve WEB UI for human users"`
-    REST         bool           `default: "true"        hide: "false"   help: "Serve REST webservice for remote devices"`
-    Listen       bool           `default: "true"        hide: "false"   help: "Listen to device advertisements on the local network"`
-    Scan         time.Duration  `default: "0"           hide: "false"   help: "Scan for devices on the local network every X seconds"`
-    Anonymous    bool           `default: "false"       hide: "false"   help: "Allow anonymous access without authentication"`
-    SelfSignup   bool           `default: "false"       hide: "false"   help: "Allow users and devices to signup themselves"`
+    UI           bool           `default:"true"        hide:"false"   help:"Serve WEB UI for human users"`
+    REST         bool           `default:"true"        hide:"false"   help:"Serve REST webservice for remote devices"`
+    Listen       bool           `default:"true"        hide:"false"   help:"Listen to device advertisements on the local network"`
+    Scan         time.Duration  `default:"0"           hide:"false"   help:"Scan for devices on the local network every X seconds"`
+    Anonymous    bool           `default:"false"       hide:"false"   help:"Allow anonymous access without authentication"`
+    SelfSignup   bool           `default:"false"       hide:"false"   help:"Allow users and devices to signup themselves"`
 }
@@ -9,3 +9,8 @@
 package conf
 
 const MaxDatagramSize = 8192
+
+// Version of fmd. Can be set at build time with
+// -ldflags "-X github.com/DennisSchulmeister/find-my-device/fmd/conf.Version=1.0.0".
+// Otherwise the module version or VCS revision from the build info is used.
+var Version = ""
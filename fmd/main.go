@@ -19,19 +19,11 @@ import (
 
 // Main function :-)
 func main() {
-    myApp  := app.NewApp()
     config := &conf.Config{}
+    myApp  := app.NewApp(config)
 
-    // TODO: Read configuration
-    config.General.Port         = 54321
-    config.General.MulticastIP4 = "224.0.0.1"
-    config.General.MulticastIP6 = "ff02::1"
-    config.Advertise.Respond    = true
-    config.Advertise.Multicast  = true
-    config.Advertise.Interval   = 15
-    config.Find.Local           = true
-    config.Listen.Timeout       = 0
-    ////
+    myApp.Configuration().AddFile("/etc/fmd/fmd.conf")
+    myApp.Configuration().AddFile("~/.config/fmd/fmd.conf")
 
     myApp.AddCommand("advertise", advertise.New(config))
     myApp.AddCommand("find", find.New(config))
@@ -9,32 +9,42 @@
 package msg
 
 import (
+    "context"
     "errors"
     "fmt"
     "net"
     "os"
     "strings"
+    "sync"
     "time"
-    "golang.org/x/exp/slices"
+    "golang.org/x/net/ipv4"
+    "golang.org/x/net/ipv6"
     "github.com/DennisSchulmeister/find-my-device/fmd/conf"
 )
 
 // Connection to multiple remote sites, encapsulating a list of net.PacketConn objects.
 // Write() will send the data to all receivers. If data needs to be received,
-// concurrent goroutines can monitor the connections and put received data
-// into a shared channel.
+// Start() launches one goroutine per connection that puts the received
+// datagrams into a shared channel.
 type Connections interface {
     // Get all open connections
     Connections() []net.PacketConn
 
+    // Get the address to which Write() sends data on the given connection
+    RemoteAddr(connection net.PacketConn) net.Addr
+
+    // Get the name of the network interface used by the given connection
+    // to send multicasts, if the connection is bound to a single interface
+    Interface(connection net.PacketConn) string
+
     // Listen for incoming data
     Start()
 
     // Stop listening for incoming data
     Stop()
 
-    // Get channel for connections with readable data
-    Read() chan ReadResult
+    // Get channel with the received datagrams
+    Read() chan Datagram
 
     // Write data to all connections
     Write(b []byte) (n int, err error)
@@ -45,9 +55,13 @@ type Connections interface {
 
 type ConnectionsStruct struct {
     connections []net.PacketConn
+    remotes     map[net.PacketConn]net.Addr
+    devices     map[net.PacketConn]string
     started     bool
-    read        chan ReadResult
-    notify      map[net.PacketConn]chan string
+    read        chan Datagram
+    stop        chan struct{}
+    running     sync.WaitGroup
+    interfaces  sync.Map
 }
 
 // Concurrent Write(): Written number of bytes and last error
@@ -56,9 +70,25 @@ type writeResult struct{
     err error
 }
 
-// Concurrent Read: Channel with available data or error
-type ReadResult struct {
+// Concurrent Read: Received datagram or error. Answers can be sent to the
+// sender with Connection.WriteTo(data, Address).
+type Datagram struct {
+    // Connection on which the datagram has been received
     Connection net.PacketConn
+
+    // Received data, at most conf.MaxDatagramSize bytes
+    Data []byte
+
+    // Address of the sender
+    Address net.Addr
+
+    // Name of the receiving network interface, if known
+    Interface string
+
+    // Time of reception
+    Time time.Time
+
+    // Error, after which no more datagrams are received on the connection
     Error error
 }
 
@@ -72,130 +102,344 @@ func ValidateConfig(config *conf.Config) error {
         return fmt.Errorf("No UDP port number has been defined")
     }
 
+    if config.General.MulticastTTL < 1 || config.General.MulticastTTL > 255 {
+        return fmt.Errorf("Multicast TTL must be between 1 and 255")
+    }
+
+    if !strings.EqualFold(config.General.Encoding, EncodingJSON) && !strings.EqualFold(config.General.Encoding, EncodingCBOR) {
+        return fmt.Errorf("Unknown encoding '%v', must be %v or %v", config.General.Encoding, EncodingJSON, EncodingCBOR)
+    }
+
+    for _, network := range []string{"udp4", "udp6"} {
+        if _, err := configInterfaceFilter(config, network); err != nil { return err }
+    }
+
     return nil
 }
 
-// Dial all IPv4 and IPv6 multicast addresses from global config
+// Dial all IPv4 and IPv6 multicast addresses from global config. One socket
+// is created per address family and selected network interface, so that
+// Write() sends a copy of the data on each interface. The sockets are not
+// connected to the multicast addresses, so that they can receive the unicast
+// answers of the devices.
 func DialMulticast(config *conf.Config) (Connections, error) {
-    this := &ConnectionsStruct{
-        connections: make([]net.PacketConn, 0),
-        started:     false,
-        read:        make(chan ReadResult),
-        notify:      make(map[net.PacketConn]chan string),
-    }
+    this := newConnections()
 
-    if config.General.MulticastIP4 != "" {
-        for i := 0; i < 1; i++ {
-            addr := fmt.Sprintf("%v:%v", config.General.MulticastIP4, config.General.Port)
-            UDPAddr, err := net.ResolveUDPAddr("udp", addr)
-            if err != nil { continue }
+    for _, network := range []string{"udp4", "udp6"} {
+        ip := config.General.MulticastIP4
+        if network == "udp6" { ip = config.General.MulticastIP6 }
+        if ip == "" { continue }
+
+        netInterfaces, err := multicastInterfaces(config, network)
+        if err != nil { return nil, err }
 
-            conn, err := net.DialUDP("udp", nil, UDPAddr)
+        for i := range netInterfaces {
+            conn, UDPAddr, err := dialMulticastInterface(config, network, ip, &netInterfaces[i])
             if err != nil { continue }
 
             this.connections = append(this.connections, conn)
+            this.remotes[conn] = UDPAddr
+            this.devices[conn] = netInterfaces[i].Name
         }
     }
 
-    if config.General.MulticastIP6 != "" {
-        allowedInterfaces := make([]string, 0)
+    if len(this.connections) == 0 {
+        return nil, fmt.Errorf("Unable to dial any address")
+    }
 
-        if strings.Contains(config.General.InterfaceIP6, ",") {
-            strings.Split(config.General.InterfaceIP6, ",")
-        }
+    return this, nil
+}
 
-        netInterfaces, err := net.Interfaces()
-        if err != nil { return nil, err }
+// Create socket to send multicasts on a single network interface. For IPv6
+// the interface is given as zone of the remote address, for IPv4 it must be
+// set as socket option.
+func dialMulticastInterface(config *conf.Config, network, ip string, netInterface *net.Interface) (net.PacketConn, *net.UDPAddr, error) {
+    host := ip
+    if network == "udp6" { host = ip + "%" + netInterface.Name }
 
-        for _, netInterface := range netInterfaces {
-            if netInterface.Flags & net.FlagUp == 0 { continue }
-            if netInterface.Flags & net.FlagMulticast == 0 { continue }
+    UDPAddr, err := net.ResolveUDPAddr(network, net.JoinHostPort(host, fmt.Sprint(config.General.Port)))
+    if err != nil { return nil, nil, err }
 
-            if len(allowedInterfaces) > 0 {
-                if !slices.Contains(allowedInterfaces, netInterface.Name) {
-                    continue
-                }
-            }
+    conn, err := net.ListenUDP(network, nil)
+    if err != nil { return nil, nil, err }
 
-            addr := fmt.Sprintf("[%v%%%v]:%v", config.General.MulticastIP6, netInterface.Name, config.General.Port)
-            UDPAddr, err := net.ResolveUDPAddr("udp", addr)
-            if err != nil { continue }
+    if network == "udp4" {
+        err = ipv4.NewPacketConn(conn).SetMulticastInterface(netInterface)
+    }
 
-            conn, err := net.DialUDP("udp", nil, UDPAddr)
-            if err != nil { continue }
+    if err == nil {
+        err = setMulticastOptions(conn, network, config)
+    }
 
-            this.connections = append(this.connections, conn)
+    if err != nil {
+        conn.Close()
+        return nil, nil, err
+    }
+
+    return conn, UDPAddr, nil
+}
+
+// Listen on the IPv4 and IPv6 multicast addresses from global config to
+// receive the datagrams sent to the multicast groups. The groups are joined
+// on all eligible network interfaces. The port is bound with SO_REUSEADDR
+// and, on BSD systems and macOS, SO_REUSEPORT, so that multiple processes on
+// the same host can listen at the same time. Write() sends to the multicast
+// groups, too.
+func ListenMulticast(config *conf.Config) (Connections, error) {
+    this := newConnections()
+    var lastErr error
+
+    for _, network := range []string{"udp4", "udp6"} {
+        ip := config.General.MulticastIP4
+        if network == "udp6" { ip = config.General.MulticastIP6 }
+        if ip == "" { continue }
+
+        conn, UDPAddr, err := listenMulticastGroup(config, network, ip)
+
+        if err != nil {
+            lastErr = err
+            continue
         }
+
+        this.connections = append(this.connections, conn)
+        this.remotes[conn] = UDPAddr
     }
 
     if len(this.connections) == 0 {
-        return nil, fmt.Errorf("Unable to dial any address")
+        return nil, fmt.Errorf("Unable to listen on any address: %v", lastErr)
     }
 
     return this, nil
 }
 
+// Bind the UDP port and join the multicast group on all eligible network
+// interfaces. Fails only if the group cannot be joined on any interface.
+func listenMulticastGroup(config *conf.Config, network, ip string) (net.PacketConn, *net.UDPAddr, error) {
+    UDPAddr, err := net.ResolveUDPAddr(network, net.JoinHostPort(ip, fmt.Sprint(config.General.Port)))
+    if err != nil { return nil, nil, err }
+
+    if !UDPAddr.IP.IsMulticast() {
+        return nil, nil, fmt.Errorf("%v is not a multicast address", ip)
+    }
+
+    netInterfaces, err := multicastInterfaces(config, network)
+    if err != nil { return nil, nil, err }
+
+    listenConfig := net.ListenConfig{Control: reuseAddress}
+    conn, err := listenConfig.ListenPacket(context.Background(), network, fmt.Sprintf(":%v", config.General.Port))
+    if err != nil { return nil, nil, err }
+
+    joined := 0
+    var joinErr error
+
+    for i := range netInterfaces {
+        if network == "udp4" {
+            err = ipv4.NewPacketConn(conn).JoinGroup(&netInterfaces[i], UDPAddr)
+        } else {
+            err = ipv6.NewPacketConn(conn).JoinGroup(&netInterfaces[i], UDPAddr)
+        }
+
+        if err != nil {
+            joinErr = fmt.Errorf("%v: %w", netInterfaces[i].Name, err)
+        } else {
+            joined++
+        }
+    }
+
+    if joined == 0 {
+        conn.Close()
+
+        if joinErr == nil {
+            joinErr = fmt.Errorf("No eligible network interface")
+        }
+
+        return nil, nil, fmt.Errorf("Unable to join multicast group %v: %w", ip, joinErr)
+    }
+
+    if err := setMulticastOptions(conn, network, config); err != nil {
+        conn.Close()
+        return nil, nil, err
+    }
+
+    return conn, UDPAddr, nil
+}
+
+// Enable multicast loopback, so that other processes on the same host receive
+// the sent datagrams, and set the TTL (IPv4) or hop limit (IPv6)
+func setMulticastOptions(conn net.PacketConn, network string, config *conf.Config) error {
+    ttl := int(config.General.MulticastTTL)
+
+    if network == "udp6" {
+        packetConn := ipv6.NewPacketConn(conn)
+        if err := packetConn.SetMulticastLoopback(true); err != nil { return err }
+        return packetConn.SetMulticastHopLimit(ttl)
+    }
+
+    packetConn := ipv4.NewPacketConn(conn)
+    if err := packetConn.SetMulticastLoopback(true); err != nil { return err }
+    return packetConn.SetMulticastTTL(ttl)
+}
+
+// Create connections object without any connection, e.g. as placeholder
+// until a network interface becomes available. Write() does nothing and
+// Read() never returns a datagram.
+func NewConnections() Connections {
+    return newConnections()
+}
+
+// Create new empty connections object
+func newConnections() *ConnectionsStruct {
+    return &ConnectionsStruct{
+        connections: make([]net.PacketConn, 0),
+        remotes:     make(map[net.PacketConn]net.Addr),
+        devices:     make(map[net.PacketConn]string),
+        started:     false,
+        read:        make(chan Datagram),
+    }
+}
+
 // Get all open connections
 func (this *ConnectionsStruct) Connections() []net.PacketConn {
     return this.connections
 }
 
-// Listen for incoming data
+// Get the address to which Write() sends data on the given connection
+func (this *ConnectionsStruct) RemoteAddr(connection net.PacketConn) net.Addr {
+    return this.remotes[connection]
+}
+
+// Get the name of the network interface used by the given connection
+func (this *ConnectionsStruct) Interface(connection net.PacketConn) string {
+    return this.devices[connection]
+}
+
+// Listen for incoming data. Starts one goroutine per connection, that reads
+// the datagrams and puts them into the this.read channel.
 func (this *ConnectionsStruct) Start() {
     if this.started { return }
     this.started = true
+    this.stop = make(chan struct{})
 
-    // For each connection call a goroutine that repeatedly probes the connection
-    // for available data. Send connections with data or error to the this.read
-    // channel. Additionally open a dedicated notify channel for each goroutine,
-    // this is used by Stop() to break the loops.
     for _, connection := range this.connections {
-        notify := make(chan string)
-        this.notify[connection] = notify
+        connection.SetReadDeadline(time.Time{})
 
-        dummy := make([]byte, 0)
+        this.running.Add(1)
+        go this.receive(connection, this.stop)
+    }
+}
 
-        go func() {
-            for {
-                err := connection.SetReadDeadline(time.Now().Add(1 * time.Second))
+// Stop listening for incoming data. Blocks until all goroutines have stopped,
+// which are interrupted by setting an expired read deadline.
+func (this *ConnectionsStruct) Stop() {
+    if !this.started { return }
+    this.started = false
 
-                if err == nil {
-                    var action string
+    close(this.stop)
 
-                    select {
-                        case action = <- notify:
-                        default:
-                            action = "read"
-                    }
+    for _, connection := range this.connections {
+        connection.SetReadDeadline(time.Now())
+    }
 
-                    if action == "quit" { break }
-                    _, _, err = connection.ReadFrom(dummy) // Besser?
-                }
+    this.running.Wait()
+}
 
-                if err == nil {
-                    this.read <- ReadResult{Connection: connection, Error: nil}
-                } else if !errors.Is(err, os.ErrDeadlineExceeded) {
-                    this.read <- ReadResult{ Connection: connection, Error: err}
-                    break
-                }
+// Get channel with the received datagrams
+func (this *ConnectionsStruct) Read() chan Datagram {
+    return this.read
+}
+
+// Read datagrams from a connection until stopped or a read error occurs
+func (this *ConnectionsStruct) receive(connection net.PacketConn, stop chan struct{}) {
+    defer this.running.Done()
+
+    readFrom := newDatagramReader(connection)
+    buffer   := make([]byte, conf.MaxDatagramSize)
+
+    for {
+        n, ifIndex, addr, err := readFrom(buffer)
+        datagram := Datagram{Connection: connection, Time: time.Now()}
+
+        if err != nil {
+            select {
+                case <- stop:
+                    return
+                default:
             }
-        }()
+
+            if errors.Is(err, os.ErrDeadlineExceeded) {
+                continue
+            }
+
+            datagram.Error = err
+        } else {
+            datagram.Data      = make([]byte, n)
+            datagram.Address   = addr
+            datagram.Interface = this.interfaceName(ifIndex)
+            copy(datagram.Data, buffer[:n])
+        }
+
+        select {
+            case this.read <- datagram:
+            case <- stop:
+                return
+        }
+
+        if err != nil {
+            return
+        }
     }
 }
 
-// Stop listening for incoming data
-func (this *ConnectionsStruct) Stop() {
-    if !this.started { return }
-    this.started = false
+// Create function to read a datagram together with the index of the
+// receiving network interface. The index is zero if it is not available
+// on the platform.
+func newDatagramReader(connection net.PacketConn) func([]byte) (int, int, net.Addr, error) {
+    UDPAddr, _ := connection.LocalAddr().(*net.UDPAddr)
 
-    for _, notify := range this.notify {
-        notify <- "quit"
+    if UDPAddr == nil {
+        return func(buffer []byte) (int, int, net.Addr, error) {
+            n, addr, err := connection.ReadFrom(buffer)
+            return n, 0, addr, err
+        }
+    }
+
+    if UDPAddr.IP.To4() != nil {
+        packetConn := ipv4.NewPacketConn(connection)
+        packetConn.SetControlMessage(ipv4.FlagInterface, true)
+
+        return func(buffer []byte) (int, int, net.Addr, error) {
+            n, controlMessage, addr, err := packetConn.ReadFrom(buffer)
+            if controlMessage == nil { return n, 0, addr, err }
+            return n, controlMessage.IfIndex, addr, err
+        }
+    }
+
+    packetConn := ipv6.NewPacketConn(connection)
+    packetConn.SetControlMessage(ipv6.FlagInterface, true)
+
+    return func(buffer []byte) (int, int, net.Addr, error) {
+        n, controlMessage, addr, err := packetConn.ReadFrom(buffer)
+        if controlMessage == nil { return n, 0, addr, err }
+        return n, controlMessage.IfIndex, addr, err
     }
 }
 
-// Get channel for connections with readable data
-func (this *ConnectionsStruct) Read() chan ReadResult {
-    return this.read
+// Get the name of a network interface by its index. The names are cached,
+// because the lookup reads the full list of network interfaces.
+func (this *ConnectionsStruct) interfaceName(index int) string {
+    if index == 0 {
+        return ""
+    }
+
+    if name, found := this.interfaces.Load(index); found {
+        return name.(string)
+    }
+
+    netInterface, err := net.InterfaceByIndex(index)
+    if err != nil { return "" }
+
+    this.interfaces.Store(index, netInterface.Name)
+    return netInterface.Name
 }
 
 // Write data to all connections. Blocks until all data is written.
@@ -205,11 +449,13 @@ func (this *ConnectionsStruct) Write(b []byte) (n int, err error) {
     results := make(chan writeResult)
 
     for _, connection := range this.connections {
+        connection := connection
+
         go func() {
             result := writeResult{}
 
             for result.n < len(b) {
-                n1, err1 := connection.Write(b)
+                n1, err1 := connection.WriteTo(b, this.remotes[connection])
                 result.n += n1
 
                 if err1 != nil {
@@ -226,7 +472,7 @@ func (this *ConnectionsStruct) Write(b []byte) (n int, err error) {
         result := <- results
 
         if result.n > n {
-            result.n = n
+            n = result.n
         }
 
         if result.err != nil {
@@ -237,10 +483,11 @@ func (this *ConnectionsStruct) Write(b []byte) (n int, err error) {
     return
 }
 
-// Close all connections.
+// Stop listening and close all connections.
 // err wraps all errors from all connections.
 func (this *ConnectionsStruct) Close() error {
     var err error
+    this.Stop()
 
     for _, connection := range this.connections {
         if err1 := connection.Close(); err1 != nil {
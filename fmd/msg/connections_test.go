@@ -0,0 +1,66 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+package msg
+
+import (
+    "net"
+    "testing"
+    "time"
+)
+
+func Test_ConnectionsReadDatagram(t *testing.T) {
+    receiver, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+    if err != nil { t.Skipf("No loopback interface: %v", err) }
+
+    sender, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+    if err != nil { t.Fatal(err) }
+    defer sender.Close()
+
+    conns := newConnections()
+    conns.connections = append(conns.connections, receiver)
+    conns.Start()
+
+    if _, err := sender.WriteTo([]byte("hello"), receiver.LocalAddr()); err != nil {
+        t.Fatal(err)
+    }
+
+    select {
+        case datagram := <- conns.Read():
+            if datagram.Error != nil {
+                t.Fatalf("Read() returned error %v", datagram.Error)
+            }
+
+            if string(datagram.Data) != "hello" {
+                t.Errorf("Read() returned %q instead of %q", datagram.Data, "hello")
+            }
+
+            if datagram.Address.String() != sender.LocalAddr().String() {
+                t.Errorf("Read() returned sender %v instead of %v", datagram.Address, sender.LocalAddr())
+            }
+
+            if datagram.Time.IsZero() {
+                t.Errorf("Read() returned no receive time")
+            }
+        case <- time.After(time.Second):
+            t.Fatalf("No datagram received")
+    }
+
+    // Close() must not block, even though nobody reads the channel anymore
+    sender.WriteTo([]byte("unread"), receiver.LocalAddr())
+    time.Sleep(10 * time.Millisecond)
+
+    closed := make(chan error, 1)
+    go func() { closed <- conns.Close() }()
+
+    select {
+        case <- closed:
+        case <- time.After(time.Second):
+            t.Errorf("Close() blocked")
+    }
+}
@@ -12,113 +12,284 @@ import (
     "bytes"
     "compress/gzip"
     "encoding/json"
+    "errors"
+    "fmt"
     "io"
-    "reflect"
     "strings"
+    "time"
+    "github.com/fxamacker/cbor/v2"
+    "github.com/DennisSchulmeister/find-my-device/fmd/conf"
 )
 
-// Encoder/Decoder to read and write messages from a byte-stream
+// Encoder/Decoder to convert messages into UDP datagrams and back. Each
+// datagram contains exactly one self-contained message, so that it can be
+// decoded without the other datagrams. See Header for the binary header in
+// front of the encoded message. Messages that are too large for a single
+// datagram can be split into fragments, that are reassembled by Decode().
+//
+// The payload is either gzip compressed JSON (the default) or CBOR, if the
+// message header has FlagCBOR set. CBOR is more compact for small messages
+// and is only compressed for larger messages, if this makes it smaller.
+// Decode() always accepts both encodings.
 type MessageCoder interface {
-    // Encode message and write it to the byte-stream
-    Write(message Message) error
+    // Encode message into a single datagram
+    Encode(message Message) ([]byte, error)
 
-    // Decode next message inside the byte-stream
-    Read() (Message, error)
+    // Encode message into one or more datagrams, if it is too large for one
+    EncodeFragments(message Message) ([][]byte, error)
 
-    // Close internal readers and writers
-    Close() error
+    // Decode message from a single datagram or the last missing fragment
+    Decode(data []byte) (Message, error)
 }
 
+// Message coder with reusable buffers. Not safe for concurrent use.
 type MessageCoderStruct struct {
-    gzipReader  *gzip.Reader
-    jsonDecoder *json.Decoder
-
     jsonBuffer  bytes.Buffer
     jsonEncoder *json.Encoder
+    gzipBuffer  bytes.Buffer
     gzipWriter  *gzip.Writer
+    gzipReader  *gzip.Reader
+    fragments   *reassemblies
 }
 
+// Error for messages that don't fit into a single datagram
+var ErrMessageTooLarge = errors.New("Message too large")
+
+// Upper limit for the uncompressed size of a received message, to reject
+// datagrams that decompress to huge amounts of data
+const maxMessageSize = 64 * conf.MaxDatagramSize
+
+// CBOR payloads smaller than this are not compressed, because the gzip
+// overhead is larger than the savings
+const minCompressSize = 256
+
 // Create new message encoder/decoder instance
-func NewMessageCoder(reader io.Reader, writer io.Writer) (MessageCoder, error) {
-    var err error
+func NewMessageCoder() MessageCoder {
     this := &MessageCoderStruct{}
+    this.jsonEncoder = json.NewEncoder(&this.jsonBuffer)
+    this.gzipWriter  = gzip.NewWriter(&this.gzipBuffer)
+    this.fragments   = newReassemblies()
+    return this
+}
 
-    if reader != nil {
-        this.gzipReader, err = gzip.NewReader(reader)
-        if err != nil { return nil, err }
-        this.jsonDecoder = json.NewDecoder(this.gzipReader)
+// Encode a single message into a self-contained datagram
+func EncodeDatagram(message Message) ([]byte, error) {
+    return NewMessageCoder().Encode(message)
+}
+
+// Encode a single message into one or more datagrams
+func EncodeDatagrams(message Message) ([][]byte, error) {
+    return NewMessageCoder().EncodeFragments(message)
+}
+
+// Decode a single message from a datagram created by EncodeDatagram().
+// Use a MessageCoder to decode fragmented messages.
+func DecodeDatagram(data []byte) (Message, error) {
+    return NewMessageCoder().Decode(data)
+}
+
+// Encode message into a single datagram. Message format is the header followed
+// by the JSON or CBOR payload. The message and instance ID of the header are set
+// automatically, unless already given. Fails with ErrMessageTooLarge, if the
+// datagram would be larger than conf.MaxDatagramSize.
+func (this *MessageCoderStruct) Encode(message Message) ([]byte, error) {
+    header, payload, err := this.encodePayload(message)
+    if err != nil { return nil, err }
+
+    if HeaderSize + len(payload) > conf.MaxDatagramSize {
+        return nil, fmt.Errorf("%w: %v bytes, maximum is %v bytes", ErrMessageTooLarge, HeaderSize + len(payload), conf.MaxDatagramSize)
+    }
+
+    data := make([]byte, 0, HeaderSize + len(payload))
+    data = header.AppendTo(data)
+    data = append(data, payload...)
+    return data, nil
+}
+
+// Encode message into one or more datagrams. Messages that don't fit into
+// a single datagram are split into up to MaxFragments fragments. Fails with
+// ErrMessageTooLarge, if even this is not enough.
+func (this *MessageCoderStruct) EncodeFragments(message Message) ([][]byte, error) {
+    header, payload, err := this.encodePayload(message)
+    if err != nil { return nil, err }
+
+    if HeaderSize + len(payload) <= conf.MaxDatagramSize {
+        data := make([]byte, 0, HeaderSize + len(payload))
+        data = header.AppendTo(data)
+        data = append(data, payload...)
+        return [][]byte{data}, nil
+    }
+
+    chunkSize := conf.MaxDatagramSize - HeaderSize - fragmentHeaderSize
+    count     := (len(payload) + chunkSize - 1) / chunkSize
+
+    if count > MaxFragments {
+        return nil, fmt.Errorf("%w: %v bytes, maximum is %v fragments", ErrMessageTooLarge, len(payload), MaxFragments)
+    }
+
+    header.Flags |= FlagFragment
+    datagrams := make([][]byte, 0, count)
+
+    for i := 0; i < count; i++ {
+        chunk := payload[i * chunkSize:]
+        if len(chunk) > chunkSize { chunk = chunk[:chunkSize] }
+
+        data := make([]byte, 0, HeaderSize + fragmentHeaderSize + len(chunk))
+        data = header.AppendTo(data)
+        data = appendFragmentHeader(data, i, count)
+        data = append(data, chunk...)
+        datagrams = append(datagrams, data)
+    }
+
+    return datagrams, nil
+}
+
+// Encode message payload and create the matching header
+func (this *MessageCoderStruct) encodePayload(message Message) (Header, []byte, error) {
+    header := message.Header
+    header.Version = ProtocolVersion
+    header.Flags  &^= FlagGzip | FlagFragment
+
+    if header.MessageID == 0 {
+        header.MessageID = NextMessageID()
+    }
+
+    if header.InstanceID == 0 {
+        header.InstanceID = InstanceID
+    }
+
+    var payload []byte
+    var err error
+
+    if header.Flags & FlagCBOR != 0 {
+        payload, err = this.encodeCBOR(message)
+    } else {
+        payload, err = this.encodeJSON(message)
+    }
+
+    if err != nil { return header, nil, err }
+
+    // Compress, unless CBOR is small or gets larger by compression
+    if header.Flags & FlagCBOR != 0 && len(payload) < minCompressSize {
+        return header, payload, nil
     }
 
-    if writer != nil {
-        this.jsonEncoder = json.NewEncoder(&this.jsonBuffer)
-        this.gzipWriter  = gzip.NewWriter(writer)
+    compressed, err := this.compress(payload)
+    if err != nil { return header, nil, err }
+
+    if header.Flags & FlagCBOR != 0 && len(compressed) >= len(payload) {
+        return header, payload, nil
     }
 
-    return this, nil
+    header.Flags |= FlagGzip
+    return header, compressed, nil
 }
 
-// Write a new message into the output stream.
-// Message format is gzip compressed json.
-func (this *MessageCoderStruct) Write(message Message) error {
+// Encode message as CBOR map without the empty fields
+func (this *MessageCoderStruct) encodeCBOR(message Message) ([]byte, error) {
+    fields := make(map[string]any)
+
+    for _, field := range message.fields() {
+        fields[field.Name] = field.Value
+    }
+
+    return cbor.Marshal(fields)
+}
+
+// Encode message as JSON without the empty fields
+func (this *MessageCoderStruct) encodeJSON(message Message) ([]byte, error) {
     // NOTE: Each field of the message struct is encoded individually to safe
     // some bytes. Because the JsonEncoder doesn't skip nil pointers but rather
     // encodes them as attributes with value "null".
     builder := strings.Builder{}
     builder.WriteString("{")
 
-    messageType  := reflect.TypeOf(message)
-    messageValue := reflect.ValueOf(message)
-    emptyObject  := true
-
-    for i := 0; i < messageValue.NumField(); i++ {
-        fieldValue := messageValue.Field(i)
-        if fieldValue.IsZero() { continue }
-
-        if !emptyObject {
+    for i, field := range message.fields() {
+        if i > 0 {
             builder.WriteString(",")
         }
 
-        emptyObject = false
-
-        fieldType  := messageType.Field(i)
         builder.WriteString("\"")
-        builder.WriteString(fieldType.Name)
+        builder.WriteString(field.Name)
         builder.WriteString("\":")
 
         this.jsonBuffer.Reset()
-        err := this.jsonEncoder.Encode(fieldValue.Interface())
-        if err != nil { return err }
+        err := this.jsonEncoder.Encode(field.Value)
+        if err != nil { return nil, err }
 
         builder.WriteString(strings.TrimSpace(this.jsonBuffer.String()))
     }
 
     builder.WriteString("}")
+    return []byte(builder.String()), nil
+}
 
-    _, err := io.WriteString(this.gzipWriter, builder.String())
-    return err
+// Compress data into a complete gzip stream
+func (this *MessageCoderStruct) compress(data []byte) ([]byte, error) {
+    this.gzipBuffer.Reset()
+    this.gzipWriter.Reset(&this.gzipBuffer)
+
+    if _, err := this.gzipWriter.Write(data); err != nil {
+        return nil, err
+    }
+
+    if err := this.gzipWriter.Close(); err != nil {
+        return nil, err
+    }
+
+    compressed := make([]byte, this.gzipBuffer.Len())
+    copy(compressed, this.gzipBuffer.Bytes())
+    return compressed, nil
 }
 
-// Read a message from the input stream
-// Message format is gzip compressed json.
-func (this *MessageCoderStruct) Read() (message Message, err error) {
-    err = this.jsonDecoder.Decode(&message)
+// Decode message from a single datagram. Message format is the header
+// followed by the JSON or CBOR payload. Fails with ErrNotFMD for datagrams of
+// other applications, UnsupportedVersionError for unknown versions and
+// UnknownMessageTypeError if the message contains no known message type.
+// Fragments are kept until all fragments of the message have been received.
+// Until then ErrIncomplete is returned.
+func (this *MessageCoderStruct) Decode(data []byte) (message Message, err error) {
+    if len(data) > conf.MaxDatagramSize {
+        return message, fmt.Errorf("%w: %v bytes, maximum is %v bytes", ErrMessageTooLarge, len(data), conf.MaxDatagramSize)
+    }
+
+    header, payload, err := ParseHeader(data)
     if err != nil { return }
+
+    if header.Flags & FlagFragment != 0 {
+        payload, err = this.fragments.add(header, payload, time.Now())
+        if err != nil { return }
+    }
+
+    if header.Flags & FlagGzip != 0 {
+        payload, err = this.decompress(payload)
+        if err != nil { return }
+    }
+
+    message, err = decodeMessage(payload, header.Flags & FlagCBOR != 0)
+    message.Header = header
+    message.Header.Flags &^= FlagFragment
     return
 }
 
-// Close internal readers and writers
-func (this *MessageCoderStruct) Close() error {
-    if this.gzipReader != nil {
-        if err := this.gzipReader.Close(); err != nil {
-            return err
-        }
+// Decompress gzip compressed payload
+func (this *MessageCoderStruct) decompress(data []byte) (decoded []byte, err error) {
+    if this.gzipReader == nil {
+        this.gzipReader, err = gzip.NewReader(bytes.NewReader(data))
+    } else {
+        err = this.gzipReader.Reset(bytes.NewReader(data))
     }
 
-    if this.gzipWriter != nil {
-        if err := this.gzipWriter.Close(); err != nil {
-            return err
-        }
+    if err != nil { return }
+
+    this.gzipReader.Multistream(false)
+
+    decoded, err = io.ReadAll(io.LimitReader(this.gzipReader, maxMessageSize + 1))
+    if err != nil { return }
+
+    if len(decoded) > maxMessageSize {
+        return nil, fmt.Errorf("%w: More than %v bytes after decompression", ErrMessageTooLarge, maxMessageSize)
     }
 
-    return nil
+    return
 }
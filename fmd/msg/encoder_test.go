@@ -0,0 +1,200 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+package msg
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "net"
+    "reflect"
+    "testing"
+)
+
+// Create device information like on a small device with a few interfaces
+func newTestDeviceInformation() Message {
+    information := &DeviceInformationMessage{
+        Group:           "lab",
+        DeviceName:      "kitchen-pi",
+        HostName:        "raspberrypi",
+        OperatingSystem: "linux",
+    }
+
+    for i := 0; i < 3; i++ {
+        information.NetworkInterfaces = append(information.NetworkInterfaces, NetworkInterface{
+            Interface: net.Interface{Index: i + 1, MTU: 1500, Name: fmt.Sprintf("eth%v", i), HardwareAddr: net.HardwareAddr{2, 0, 0, 0, 0, byte(i)}, Flags: net.FlagUp | net.FlagMulticast},
+            Addresses: []NetworkAddress{
+                {Network: "ip+net", Address: fmt.Sprintf("192.168.%v.10/24", i)},
+                {Network: "ip+net", Address: fmt.Sprintf("fe80::%v:ff:fe00:1/64", i)},
+            },
+            Multicast: []NetworkAddress{
+                {Network: "ip", Address: "224.0.0.1"},
+                {Network: "ip", Address: "ff02::1"},
+            },
+        })
+    }
+
+    return Message{DeviceInformation: information}
+}
+
+func Test_EncodeDecodeDatagram(t *testing.T) {
+    messages := []Message{
+        NewDeviceInformationRequest("lab", []string{"kitchen-pi"}),
+        {DeviceAdvertisement: &DeviceAdvertisementMessage{Group: "lab", DeviceName: "kitchen-pi", HostName: "pi"}},
+        newTestDeviceInformation(),
+    }
+
+    coder := NewMessageCoder()
+
+    for i := range messages {
+        cborMessage := messages[i]
+        cborMessage.Header.Flags = FlagCBOR
+        messages = append(messages, cborMessage)
+    }
+
+    for _, message := range messages {
+        encoding := message.Header.Flags & FlagCBOR
+
+        data, err := coder.Encode(message)
+        if err != nil { t.Fatalf("Encode() failed: %v", err) }
+
+        decoded, err := coder.Decode(data)
+        if err != nil { t.Fatalf("Decode() failed: %v", err) }
+
+        if decoded.Header.Version != ProtocolVersion || decoded.Header.MessageID == 0 || decoded.Header.InstanceID != InstanceID {
+            t.Errorf("Decode() returned invalid header %+v", decoded.Header)
+        }
+
+        if decoded.Header.Flags & FlagCBOR != encoding {
+            t.Errorf("Decode() returned flags %v for encoding %v", decoded.Header.Flags, encoding)
+        }
+
+        decoded.Header = Header{}
+        message.Header = Header{}
+
+        if !reflect.DeepEqual(decoded, message) {
+            t.Errorf("Decode() returned %+v instead of %+v", decoded, message)
+        }
+    }
+}
+
+func Test_EncodeDatagramTooLarge(t *testing.T) {
+    random := make([]byte, 8192)
+    rand.Read(random)
+
+    message := Message{DeviceAdvertisement: &DeviceAdvertisementMessage{DeviceName: hex.EncodeToString(random)}}
+
+    if _, err := EncodeDatagram(message); !errors.Is(err, ErrMessageTooLarge) {
+        t.Errorf("EncodeDatagram() returned %v instead of ErrMessageTooLarge", err)
+    }
+}
+
+func Test_DecodeDatagramInvalid(t *testing.T) {
+    data, err := EncodeDatagram(NewDeviceInformationRequest("", nil))
+    if err != nil { t.Fatal(err) }
+
+    if _, err := DecodeDatagram(data[:len(data) / 2]); err == nil {
+        t.Errorf("DecodeDatagram() accepted truncated datagram")
+    }
+
+    if _, err := DecodeDatagram([]byte("garbage")); err == nil {
+        t.Errorf("DecodeDatagram() accepted garbage")
+    }
+}
+
+func Test_DecodeDatagramHeader(t *testing.T) {
+    data, err := EncodeDatagram(NewDeviceInformationRequest("", nil))
+    if err != nil { t.Fatal(err) }
+
+    if _, err := DecodeDatagram([]byte("GET / HTTP/1.1\r\n\r\n")); !errors.Is(err, ErrNotFMD) {
+        t.Errorf("DecodeDatagram() returned %v instead of ErrNotFMD", err)
+    }
+
+    data[3] = ProtocolVersion + 1
+    var versionError *UnsupportedVersionError
+
+    if _, err := DecodeDatagram(data); !errors.As(err, &versionError) {
+        t.Errorf("DecodeDatagram() returned %v instead of UnsupportedVersionError", err)
+    }
+}
+
+func Test_MessageIDs(t *testing.T) {
+    message := NewDeviceInformationRequest("", nil)
+    message.Header.MessageID = 4711
+
+    data, err := EncodeDatagram(message)
+    if err != nil { t.Fatal(err) }
+
+    header, _, err := ParseHeader(data)
+    if err != nil { t.Fatal(err) }
+
+    if header.MessageID != 4711 {
+        t.Errorf("Given message ID %v was replaced with %v", 4711, header.MessageID)
+    }
+
+    if NextMessageID() == NextMessageID() {
+        t.Errorf("NextMessageID() returned the same ID twice")
+    }
+}
+
+func Test_DecodeDatagramUnknownFlags(t *testing.T) {
+    data, err := EncodeDatagram(NewDeviceInformationRequest("", nil))
+    if err != nil { t.Fatal(err) }
+
+    data[4] |= 0x80
+    var flagsError *UnsupportedFlagsError
+
+    if _, err := DecodeDatagram(data); !errors.As(err, &flagsError) {
+        t.Errorf("DecodeDatagram() returned %v instead of UnsupportedFlagsError", err)
+    }
+}
+
+func benchmarkEncode(b *testing.B, message Message, flags HeaderFlags) {
+    coder := NewMessageCoder()
+    message.Header.Flags = flags
+
+    data, err := coder.Encode(message)
+    if err != nil { b.Fatal(err) }
+
+    b.ReportAllocs()
+    b.ResetTimer()
+
+    for i := 0; i < b.N; i++ {
+        coder.Encode(message)
+    }
+
+    b.ReportMetric(float64(len(data)), "bytes/datagram")
+}
+
+func benchmarkDecode(b *testing.B, message Message, flags HeaderFlags) {
+    coder := NewMessageCoder()
+    message.Header.Flags = flags
+
+    data, err := coder.Encode(message)
+    if err != nil { b.Fatal(err) }
+
+    b.ReportAllocs()
+    b.ResetTimer()
+
+    for i := 0; i < b.N; i++ {
+        coder.Decode(data)
+    }
+}
+
+var benchmarkAdvertisement = Message{DeviceAdvertisement: &DeviceAdvertisementMessage{Group: "lab", DeviceName: "kitchen-pi", HostName: "raspberrypi"}}
+
+func Benchmark_EncodeAdvertisementJSON(b *testing.B)       { benchmarkEncode(b, benchmarkAdvertisement, 0) }
+func Benchmark_EncodeAdvertisementCBOR(b *testing.B)       { benchmarkEncode(b, benchmarkAdvertisement, FlagCBOR) }
+func Benchmark_DecodeAdvertisementJSON(b *testing.B)       { benchmarkDecode(b, benchmarkAdvertisement, 0) }
+func Benchmark_DecodeAdvertisementCBOR(b *testing.B)       { benchmarkDecode(b, benchmarkAdvertisement, FlagCBOR) }
+func Benchmark_EncodeDeviceInformationJSON(b *testing.B)   { benchmarkEncode(b, newTestDeviceInformation(), 0) }
+func Benchmark_EncodeDeviceInformationCBOR(b *testing.B)   { benchmarkEncode(b, newTestDeviceInformation(), FlagCBOR) }
+func Benchmark_DecodeDeviceInformationJSON(b *testing.B)   { benchmarkDecode(b, newTestDeviceInformation(), 0) }
+func Benchmark_DecodeDeviceInformationCBOR(b *testing.B)   { benchmarkDecode(b, newTestDeviceInformation(), FlagCBOR) }
@@ -0,0 +1,150 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+package msg
+
+import (
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "time"
+)
+
+// Messages larger than a single datagram are split into fragments. Each
+// fragment carries the header of the message with FlagFragment set, followed
+// by the fragment index and the number of fragments (two bytes each, big
+// endian) and a part of the payload. The receiver collects the fragments by
+// message and instance ID and decodes the message once all are received.
+
+// Maximum number of fragments per message
+const MaxFragments = 32
+
+// Maximum number of messages that are reassembled at the same time. When
+// exceeded, the oldest incomplete message is dropped.
+const MaxReassemblies = 16
+
+// Time after which incomplete messages are dropped
+const FragmentTimeout = 5 * time.Second
+
+// Size of the fragment header after the message header
+const fragmentHeaderSize = 4
+
+// Error for fragments, that didn't complete their message yet
+var ErrIncomplete = errors.New("Incomplete message")
+
+// Message whose fragments are being received
+type reassembly struct {
+    started   time.Time
+    fragments [][]byte
+    missing   int
+}
+
+// Identification of a fragmented message
+type reassemblyKey struct {
+    instanceID uint64
+    messageID  uint32
+}
+
+// Messages whose fragments are being received
+type reassemblies struct {
+    messages map[reassemblyKey]*reassembly
+}
+
+// Create new empty list of reassemblies
+func newReassemblies() *reassemblies {
+    return &reassemblies{
+        messages: make(map[reassemblyKey]*reassembly),
+    }
+}
+
+// Append fragment header to a byte slice
+func appendFragmentHeader(data []byte, index, count int) []byte {
+    data = binary.BigEndian.AppendUint16(data, uint16(index))
+    data = binary.BigEndian.AppendUint16(data, uint16(count))
+    return data
+}
+
+// Add received fragment. Returns the complete payload, once all fragments
+// have been received. Until then ErrIncomplete is returned.
+func (this *reassemblies) add(header Header, data []byte, now time.Time) ([]byte, error) {
+    if len(data) < fragmentHeaderSize {
+        return nil, fmt.Errorf("Invalid fragment: Missing fragment header")
+    }
+
+    index := int(binary.BigEndian.Uint16(data[0:2]))
+    count := int(binary.BigEndian.Uint16(data[2:4]))
+
+    if count < 1 || count > MaxFragments || index >= count {
+        return nil, fmt.Errorf("Invalid fragment %v of %v", index + 1, count)
+    }
+
+    this.expire(now)
+
+    key := reassemblyKey{instanceID: header.InstanceID, messageID: header.MessageID}
+    message, found := this.messages[key]
+
+    if !found {
+        if len(this.messages) >= MaxReassemblies {
+            this.dropOldest()
+        }
+
+        message = &reassembly{
+            started:   now,
+            fragments: make([][]byte, count),
+            missing:   count,
+        }
+
+        this.messages[key] = message
+    }
+
+    if len(message.fragments) != count {
+        delete(this.messages, key)
+        return nil, fmt.Errorf("Invalid fragment: Number of fragments changed from %v to %v", len(message.fragments), count)
+    }
+
+    if message.fragments[index] == nil {
+        message.fragments[index] = append([]byte{}, data[fragmentHeaderSize:]...)
+        message.missing--
+    }
+
+    if message.missing > 0 {
+        return nil, ErrIncomplete
+    }
+
+    delete(this.messages, key)
+    payload := make([]byte, 0)
+
+    for _, fragment := range message.fragments {
+        payload = append(payload, fragment...)
+    }
+
+    return payload, nil
+}
+
+// Drop incomplete messages after FragmentTimeout
+func (this *reassemblies) expire(now time.Time) {
+    for key, message := range this.messages {
+        if now.Sub(message.started) > FragmentTimeout {
+            delete(this.messages, key)
+        }
+    }
+}
+
+// Drop the oldest incomplete message
+func (this *reassemblies) dropOldest() {
+    var oldestKey reassemblyKey
+    var oldest *reassembly
+
+    for key, message := range this.messages {
+        if oldest == nil || message.started.Before(oldest.started) {
+            oldestKey, oldest = key, message
+        }
+    }
+
+    delete(this.messages, oldestKey)
+}
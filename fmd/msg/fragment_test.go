@@ -0,0 +1,83 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+package msg
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "errors"
+    "testing"
+    "time"
+)
+
+// Create message that needs about three datagrams
+func newLargeMessage() Message {
+    random := make([]byte, 10000)
+    rand.Read(random)
+
+    return Message{DeviceAdvertisement: &DeviceAdvertisementMessage{DeviceName: hex.EncodeToString(random)}}
+}
+
+func Test_FragmentReassembly(t *testing.T) {
+    message := newLargeMessage()
+
+    datagrams, err := EncodeDatagrams(message)
+    if err != nil { t.Fatal(err) }
+
+    if len(datagrams) < 2 {
+        t.Fatalf("EncodeDatagrams() returned %v datagrams instead of multiple fragments", len(datagrams))
+    }
+
+    coder := NewMessageCoder()
+
+    for i := len(datagrams) - 1; i > 0; i-- {
+        if _, err := coder.Decode(datagrams[i]); !errors.Is(err, ErrIncomplete) {
+            t.Errorf("Decode() of fragment %v returned %v instead of ErrIncomplete", i, err)
+        }
+    }
+
+    // Duplicates must be ignored
+    coder.Decode(datagrams[1])
+
+    decoded, err := coder.Decode(datagrams[0])
+    if err != nil { t.Fatalf("Decode() of last fragment failed: %v", err) }
+
+    if decoded.DeviceAdvertisement == nil || decoded.DeviceAdvertisement.DeviceName != message.DeviceAdvertisement.DeviceName {
+        t.Errorf("Decode() returned a different message")
+    }
+}
+
+func Test_FragmentLimits(t *testing.T) {
+    fragments := newReassemblies()
+    now := time.Now()
+
+    for i := 0; i < MaxReassemblies + 1; i++ {
+        header := Header{MessageID: uint32(i + 1)}
+        data   := appendFragmentHeader(nil, 0, 2)
+        fragments.add(header, data, now.Add(time.Duration(i) * time.Millisecond))
+    }
+
+    if len(fragments.messages) != MaxReassemblies {
+        t.Errorf("%v messages are reassembled instead of %v", len(fragments.messages), MaxReassemblies)
+    }
+
+    if _, found := fragments.messages[reassemblyKey{messageID: 1}]; found {
+        t.Errorf("Oldest message has not been dropped")
+    }
+
+    fragments.add(Header{MessageID: 4711}, appendFragmentHeader(nil, 0, 2), now.Add(FragmentTimeout + time.Second))
+
+    if len(fragments.messages) != 1 {
+        t.Errorf("Expired messages have not been dropped")
+    }
+
+    if _, err := fragments.add(Header{}, appendFragmentHeader(nil, 2, 2), now); err == nil {
+        t.Errorf("Invalid fragment index has been accepted")
+    }
+}
@@ -0,0 +1,161 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+package msg
+
+import (
+    "bytes"
+    "crypto/rand"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "strings"
+    "sync/atomic"
+)
+
+// Binary header in front of every datagram. All numbers are big endian:
+//
+//      Offset  Size  Field
+//      0       3     Magic bytes "FMD"
+//      3       1     Protocol version
+//      4       2     Flags
+//      6       4     Message ID, unique per sender instance
+//      10      8     Sender instance ID, random for each process
+//
+// The header allows receivers to drop datagrams of other applications that
+// use the same port and to evolve the message format.
+type Header struct {
+    Version    uint8
+    Flags      HeaderFlags
+    MessageID  uint32
+    InstanceID uint64
+}
+
+// Flags describing the payload after the header
+type HeaderFlags uint16
+
+const (
+    // Payload is gzip compressed
+    FlagGzip HeaderFlags = 1 << iota
+
+    // Datagram contains only a fragment of the payload
+    FlagFragment
+
+    // Payload is encoded as CBOR instead of JSON
+    FlagCBOR
+)
+
+// Names of the payload encodings for the configuration
+const (
+    EncodingJSON = "json"
+    EncodingCBOR = "cbor"
+)
+
+// Get the header flags that select the payload encoding with the given name.
+// Unknown names select JSON, see ValidateConfig().
+func EncodingFlags(encoding string) HeaderFlags {
+    if strings.EqualFold(encoding, EncodingCBOR) {
+        return FlagCBOR
+    }
+
+    return 0
+}
+
+// All flags known by this version of the program
+const knownFlags = FlagGzip | FlagFragment | FlagCBOR
+
+// Current protocol version
+const ProtocolVersion uint8 = 1
+
+// Size of the encoded header in bytes
+const HeaderSize = 18
+
+// Magic bytes at the beginning of each datagram
+var magic = []byte("FMD")
+
+// Error for datagrams that don't start with the magic bytes
+var ErrNotFMD = errors.New("Not an fmd datagram")
+
+// Error for datagrams with an unknown protocol version
+type UnsupportedVersionError struct {
+    Version uint8
+}
+
+func (this *UnsupportedVersionError) Error() string {
+    return fmt.Sprintf("Unsupported protocol version %v, expected version %v", this.Version, ProtocolVersion)
+}
+
+// Error for datagrams with flags unknown to this version of the program,
+// e.g. a newer payload encoding
+type UnsupportedFlagsError struct {
+    Flags HeaderFlags
+}
+
+func (this *UnsupportedFlagsError) Error() string {
+    return fmt.Sprintf("Unsupported header flags 0x%04x", uint16(this.Flags &^ knownFlags))
+}
+
+// Random ID of this process, so that receivers can tell the senders apart
+var InstanceID = newInstanceID()
+
+// Last used message ID
+var lastMessageID uint32
+
+// Create random instance ID
+func newInstanceID() uint64 {
+    buffer := make([]byte, 8)
+
+    if _, err := rand.Read(buffer); err != nil {
+        panic(err)
+    }
+
+    return binary.BigEndian.Uint64(buffer)
+}
+
+// Get next message ID of this process
+func NextMessageID() uint32 {
+    return atomic.AddUint32(&lastMessageID, 1)
+}
+
+// Append encoded header to a byte slice
+func (this Header) AppendTo(data []byte) []byte {
+    data = append(data, magic...)
+    data = append(data, this.Version)
+    data = binary.BigEndian.AppendUint16(data, uint16(this.Flags))
+    data = binary.BigEndian.AppendUint32(data, this.MessageID)
+    data = binary.BigEndian.AppendUint64(data, this.InstanceID)
+    return data
+}
+
+// Parse header at the beginning of a datagram. Returns the header and the
+// remaining payload. Fails with ErrNotFMD for datagrams of other applications,
+// with UnsupportedVersionError for unknown protocol versions and with
+// UnsupportedFlagsError for unknown flags.
+func ParseHeader(data []byte) (Header, []byte, error) {
+    header := Header{}
+
+    if len(data) < HeaderSize || !bytes.Equal(data[:len(magic)], magic) {
+        return header, nil, ErrNotFMD
+    }
+
+    header.Version = data[3]
+
+    if header.Version != ProtocolVersion {
+        return header, nil, &UnsupportedVersionError{Version: header.Version}
+    }
+
+    header.Flags      = HeaderFlags(binary.BigEndian.Uint16(data[4:6]))
+    header.MessageID  = binary.BigEndian.Uint32(data[6:10])
+    header.InstanceID = binary.BigEndian.Uint64(data[10:18])
+
+    if header.Flags &^ knownFlags != 0 {
+        return header, nil, &UnsupportedFlagsError{Flags: header.Flags}
+    }
+
+    return header, data[HeaderSize:], nil
+}
@@ -0,0 +1,131 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+package msg
+
+import (
+    "fmt"
+    "net"
+    "path"
+    "strings"
+    "github.com/DennisSchulmeister/find-my-device/fmd/conf"
+)
+
+// Selection of network interfaces by their names. The selection is given as
+// a comma-separated list of glob patterns (see path.Match). Patterns starting
+// with "!" deny the matching interfaces. If there are no allowing patterns,
+// all interfaces that are not denied are selected, e.g.:
+//
+//      eth*,wlan0      Only eth0, eth1, … and wlan0
+//      !docker*,!veth* All interfaces except docker0, veth1234, …
+//      eth*,!eth2      All eth interfaces except eth2
+type interfaceFilter struct {
+    allow []string
+    deny  []string
+}
+
+// Parse comma-separated list of interface patterns. An empty list selects
+// all interfaces.
+func parseInterfaceFilter(list string) (*interfaceFilter, error) {
+    this := &interfaceFilter{
+        allow: make([]string, 0),
+        deny:  make([]string, 0),
+    }
+
+    for _, pattern := range strings.Split(list, ",") {
+        pattern = strings.TrimSpace(pattern)
+        deny   := strings.HasPrefix(pattern, "!")
+
+        if deny {
+            pattern = strings.TrimSpace(pattern[1:])
+        }
+
+        if pattern == "" { continue }
+
+        if _, err := path.Match(pattern, ""); err != nil {
+            return nil, fmt.Errorf("Invalid interface pattern '%v'", pattern)
+        }
+
+        if deny {
+            this.deny = append(this.deny, pattern)
+        } else {
+            this.allow = append(this.allow, pattern)
+        }
+    }
+
+    return this, nil
+}
+
+// Check, whether the interface with the given name is selected
+func (this *interfaceFilter) matches(name string) bool {
+    for _, pattern := range this.deny {
+        if matched, _ := path.Match(pattern, name); matched { return false }
+    }
+
+    if len(this.allow) == 0 {
+        return true
+    }
+
+    for _, pattern := range this.allow {
+        if matched, _ := path.Match(pattern, name); matched { return true }
+    }
+
+    return false
+}
+
+// Get the interface selection for the given network from global config
+func configInterfaceFilter(config *conf.Config, network string) (*interfaceFilter, error) {
+    if network == "udp6" {
+        return parseInterfaceFilter(config.General.InterfaceIP6)
+    }
+
+    return parseInterfaceFilter(config.General.InterfaceIP4)
+}
+
+// Get the network interfaces that can be used for multicast on the given
+// network ("udp4" or "udp6"). The interfaces must be up, multicast capable,
+// have an address of the network's family and be selected by the
+// InterfaceIP4 or InterfaceIP6 config value.
+func multicastInterfaces(config *conf.Config, network string) ([]net.Interface, error) {
+    filter, err := configInterfaceFilter(config, network)
+    if err != nil { return nil, err }
+
+    netInterfaces, err := net.Interfaces()
+    if err != nil { return nil, err }
+
+    result := make([]net.Interface, 0)
+
+    for _, netInterface := range netInterfaces {
+        if netInterface.Flags & net.FlagUp == 0 { continue }
+        if netInterface.Flags & net.FlagMulticast == 0 { continue }
+        if !filter.matches(netInterface.Name) { continue }
+        if !hasAddressFamily(netInterface, network) { continue }
+
+        result = append(result, netInterface)
+    }
+
+    return result, nil
+}
+
+// Check, whether the network interface has an address of the network's
+// family. Interfaces without an IPv4 address cannot send IPv4 multicasts.
+func hasAddressFamily(netInterface net.Interface, network string) bool {
+    netAddresses, err := netInterface.Addrs()
+    if err != nil { return false }
+
+    for _, netAddress := range netAddresses {
+        ipNet, ok := netAddress.(*net.IPNet)
+        if !ok { continue }
+
+        if (ipNet.IP.To4() != nil) == (network == "udp4") {
+            return true
+        }
+    }
+
+    return false
+}
@@ -0,0 +1,51 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+package msg
+
+import (
+    "testing"
+)
+
+func Test_InterfaceFilter(t *testing.T) {
+    tests := []struct {
+        list    string
+        name    string
+        matches bool
+    }{
+        {"",                "eth0",    true},
+        {"eth0",            "eth0",    true},
+        {"eth0",            "eth1",    false},
+        {"eth*, wlan0",     "eth1",    true},
+        {"eth*, wlan0",     "wlan0",   true},
+        {"eth*, wlan0",     "wlan1",   false},
+        {"!docker*",        "eth0",    true},
+        {"!docker*",        "docker0", false},
+        {"eth*,!eth2",      "eth1",    true},
+        {"eth*,!eth2",      "eth2",    false},
+        {"!eth2,eth*",      "eth2",    false},
+        {" , ! ,",          "lo",      true},
+    }
+
+    for _, test := range tests {
+        filter, err := parseInterfaceFilter(test.list)
+
+        if err != nil {
+            t.Errorf("parseInterfaceFilter(%q) returned error %v", test.list, err)
+            continue
+        }
+
+        if matches := filter.matches(test.name); matches != test.matches {
+            t.Errorf("Filter %q matches %q: %v instead of %v", test.list, test.name, matches, test.matches)
+        }
+    }
+
+    if _, err := parseInterfaceFilter("eth[0"); err == nil {
+        t.Errorf("parseInterfaceFilter() accepted invalid pattern")
+    }
+}
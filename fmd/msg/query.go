@@ -0,0 +1,98 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+package msg
+
+import (
+    "context"
+    "errors"
+    "log"
+    "net"
+    "time"
+)
+
+// Answer to a request, with the addresses from which it has been received.
+// A device that can be reached via multiple connections, e.g. via IPv4 and
+// IPv6, answers on each of them but is only contained once.
+type Response struct {
+    Message   Message
+    Addresses []net.Addr
+}
+
+// Send request via all connections and collect the answers until the deadline
+// or until the context is cancelled. Answers to other requests, e.g. late
+// answers to a previous request, are dropped. Answers from the same sender
+// instance are merged. Fragmented answers are reassembled. The connections
+// must have been started. On cancellation the answers received so far are
+// returned with the error of the context.
+func Query(ctx context.Context, conns Connections, request Message, deadline time.Time) ([]Response, error) {
+    if request.Header.MessageID == 0 {
+        request.Header.MessageID = NextMessageID()
+    }
+
+    data, err := EncodeDatagram(request)
+    if err != nil { return nil, err }
+
+    if _, err := conns.Write(data); err != nil {
+        log.Printf("%v", err)
+    }
+
+    coder     := NewMessageCoder()
+    responses := make([]Response, 0)
+    instances := make(map[uint64]int)
+    timeout   := time.NewTimer(time.Until(deadline))
+    defer timeout.Stop()
+
+    for {
+        select {
+            case <- ctx.Done():
+                return responses, ctx.Err()
+
+            case <- timeout.C:
+                return responses, nil
+
+            case datagram := <- conns.Read():
+                if datagram.Error != nil {
+                    log.Printf("%v", datagram.Error)
+                    continue
+                }
+
+                message, err := coder.Decode(datagram.Data)
+
+                if errors.Is(err, ErrNotFMD) || errors.Is(err, ErrIncomplete) {
+                    continue
+                } else if err != nil {
+                    log.Printf("Ignoring datagram from %v: %v", datagram.Address, err)
+                    continue
+                }
+
+                if message.InReplyTo != request.Header.MessageID {
+                    continue
+                }
+
+                if i, found := instances[message.Header.InstanceID]; found {
+                    responses[i].Addresses = appendAddress(responses[i].Addresses, datagram.Address)
+                    continue
+                }
+
+                instances[message.Header.InstanceID] = len(responses)
+                responses = append(responses, Response{Message: message, Addresses: []net.Addr{datagram.Address}})
+        }
+    }
+}
+
+// Append address to the list, unless it is already contained
+func appendAddress(addresses []net.Addr, address net.Addr) []net.Addr {
+    for _, existing := range addresses {
+        if existing.String() == address.String() {
+            return addresses
+        }
+    }
+
+    return append(addresses, address)
+}
@@ -0,0 +1,76 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+package msg
+
+import (
+    "context"
+    "net"
+    "testing"
+    "time"
+)
+
+func Test_Query(t *testing.T) {
+    loopback := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}
+
+    client, err := net.ListenUDP("udp4", loopback)
+    if err != nil { t.Skipf("No loopback interface: %v", err) }
+
+    server1, err := net.ListenUDP("udp4", loopback)
+    if err != nil { t.Fatal(err) }
+    defer server1.Close()
+
+    server2, err := net.ListenUDP("udp4", loopback)
+    if err != nil { t.Fatal(err) }
+    defer server2.Close()
+
+    conns := newConnections()
+    conns.connections = append(conns.connections, client)
+    conns.remotes[client] = server1.LocalAddr()
+    conns.Start()
+    defer conns.Close()
+
+    // Answer the request from two addresses with the same instance ID,
+    // like a device with IPv4 and IPv6, plus a late answer to another request
+    go func() {
+        buffer := make([]byte, 8192)
+        n, addr, err := server1.ReadFrom(buffer)
+        if err != nil { return }
+
+        request, err := DecodeDatagram(buffer[:n])
+        if err != nil { return }
+
+        answer := Message{DeviceInformation: &DeviceInformationMessage{DeviceName: "pi"}}
+        answer.Header.InstanceID = 42
+
+        answer.InReplyTo = request.Header.MessageID - 1
+        data, _ := EncodeDatagram(answer)
+        server1.WriteTo(data, addr)
+
+        answer.InReplyTo = request.Header.MessageID
+        data, _ = EncodeDatagram(answer)
+        server1.WriteTo(data, addr)
+        server2.WriteTo(data, addr)
+    }()
+
+    request := NewDeviceInformationRequest("", nil)
+    responses, err := Query(context.Background(), conns, request, time.Now().Add(200 * time.Millisecond))
+    if err != nil { t.Fatal(err) }
+
+    if len(responses) != 1 {
+        t.Fatalf("Query() returned %v responses instead of 1", len(responses))
+    }
+
+    if len(responses[0].Addresses) != 2 {
+        t.Errorf("Query() returned addresses %v instead of two addresses", responses[0].Addresses)
+    }
+
+    if responses[0].Message.DeviceInformation == nil || responses[0].Message.DeviceInformation.DeviceName != "pi" {
+        t.Errorf("Query() returned wrong message %+v", responses[0].Message)
+    }
+}
@@ -0,0 +1,187 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+package msg
+
+import (
+    "encoding/json"
+    "fmt"
+    "reflect"
+    "sort"
+    "strings"
+    "sync"
+    "github.com/fxamacker/cbor/v2"
+)
+
+// Besides the message types built into the Message struct, other packages
+// can register their own message types, usually in an init() function:
+//
+//      type HeartbeatMessage struct {
+//          Uptime int64
+//      }
+//
+//      func init() {
+//          msg.RegisterMessageType("Heartbeat", func() any { return &HeartbeatMessage{} })
+//      }
+//
+// Registered messages are sent and received via Message.Extensions with the
+// type name as key. On the wire each message type is a key of the encoded
+// object, e.g. {"Heartbeat": {"Uptime": 42}}, so that receivers can skip
+// the message types that they don't know.
+
+// Registered message types with a function to create an empty instance
+var messageTypes = make(map[string]func() any)
+var messageTypesMutex sync.RWMutex
+
+// Register additional message type. Panics if the name is already taken.
+func RegisterMessageType(name string, create func() any) {
+    messageTypesMutex.Lock()
+    defer messageTypesMutex.Unlock()
+
+    if _, found := reflect.TypeOf(Message{}).FieldByName(name); found {
+        panic(fmt.Sprintf("Message type %v is built into the Message struct", name))
+    }
+
+    if _, found := messageTypes[name]; found {
+        panic(fmt.Sprintf("Message type %v has already been registered", name))
+    }
+
+    messageTypes[name] = create
+}
+
+// Get function to create an instance of a registered message type
+func lookupMessageType(name string) (func() any, bool) {
+    messageTypesMutex.RLock()
+    defer messageTypesMutex.RUnlock()
+
+    create, found := messageTypes[name]
+    return create, found
+}
+
+// Error for messages that don't contain any known message type
+type UnknownMessageTypeError struct {
+    Types []string
+}
+
+func (this *UnknownMessageTypeError) Error() string {
+    if len(this.Types) == 0 {
+        return "Message contains no message type"
+    }
+
+    return fmt.Sprintf("Unknown message type %v", strings.Join(this.Types, ", "))
+}
+
+// Field of an encoded message
+type messageField struct {
+    Name  string
+    Value any
+}
+
+// Get all fields of the message that need to be encoded: The non-empty
+// fields of the Message struct and the extensions, sorted by name.
+// Panics if an extension has not been registered.
+func (this Message) fields() []messageField {
+    fields := make([]messageField, 0)
+
+    messageType  := reflect.TypeOf(this)
+    messageValue := reflect.ValueOf(this)
+
+    for i := 0; i < messageValue.NumField(); i++ {
+        fieldValue := messageValue.Field(i)
+        if fieldValue.IsZero() { continue }
+        if messageType.Field(i).Tag.Get("json") == "-" { continue }
+
+        fields = append(fields, messageField{Name: messageType.Field(i).Name, Value: fieldValue.Interface()})
+    }
+
+    names := make([]string, 0, len(this.Extensions))
+
+    for name := range this.Extensions {
+        if _, found := lookupMessageType(name); !found {
+            panic(fmt.Sprintf("Message type %v has not been registered", name))
+        }
+
+        names = append(names, name)
+    }
+
+    sort.Strings(names)
+
+    for _, name := range names {
+        fields = append(fields, messageField{Name: name, Value: this.Extensions[name]})
+    }
+
+    return fields
+}
+
+// Decode JSON or CBOR payload into the fields of the Message struct and the
+// registered extensions. Unknown message types are skipped, but fail with
+// UnknownMessageTypeError if the message contains no known message type.
+func decodeMessage(payload []byte, isCBOR bool) (Message, error) {
+    message   := Message{}
+    unmarshal := json.Unmarshal
+    raw       := make(map[string][]byte)
+
+    if isCBOR {
+        unmarshal = cbor.Unmarshal
+        var fields map[string]cbor.RawMessage
+
+        if err := cbor.Unmarshal(payload, &fields); err != nil { return message, err }
+        for name, value := range fields { raw[name] = value }
+    } else {
+        var fields map[string]json.RawMessage
+
+        if err := json.Unmarshal(payload, &fields); err != nil { return message, err }
+        for name, value := range fields { raw[name] = value }
+    }
+
+    messageValue := reflect.ValueOf(&message).Elem()
+    known   := 0
+    unknown := make([]string, 0)
+
+    for name, value := range raw {
+        field, found := messageValue.Type().FieldByName(name)
+
+        if found && field.Tag.Get("json") != "-" {
+            fieldValue := messageValue.FieldByIndex(field.Index)
+
+            if err := unmarshal(value, fieldValue.Addr().Interface()); err != nil {
+                return message, fmt.Errorf("%v: %w", name, err)
+            }
+
+            if fieldValue.Kind() == reflect.Pointer { known++ }
+            continue
+        }
+
+        create, found := lookupMessageType(name)
+
+        if !found {
+            unknown = append(unknown, name)
+            continue
+        }
+
+        extension := create()
+
+        if err := unmarshal(value, extension); err != nil {
+            return message, fmt.Errorf("%v: %w", name, err)
+        }
+
+        if message.Extensions == nil {
+            message.Extensions = make(map[string]any)
+        }
+
+        message.Extensions[name] = extension
+        known++
+    }
+
+    if known == 0 {
+        sort.Strings(unknown)
+        return message, &UnknownMessageTypeError{Types: unknown}
+    }
+
+    return message, nil
+}
@@ -0,0 +1,68 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+package msg
+
+import (
+    "errors"
+    "testing"
+)
+
+type testHeartbeatMessage struct {
+    Uptime int64
+}
+
+func init() {
+    RegisterMessageType("TestHeartbeat", func() any { return &testHeartbeatMessage{} })
+}
+
+func Test_RegisteredMessageType(t *testing.T) {
+    for _, flags := range []HeaderFlags{0, FlagCBOR} {
+        message := Message{Extensions: map[string]any{"TestHeartbeat": &testHeartbeatMessage{Uptime: 42}}}
+        message.Header.Flags = flags
+
+        data, err := EncodeDatagram(message)
+        if err != nil { t.Fatal(err) }
+
+        decoded, err := DecodeDatagram(data)
+        if err != nil { t.Fatalf("DecodeDatagram() failed: %v", err) }
+
+        heartbeat, ok := decoded.Extensions["TestHeartbeat"].(*testHeartbeatMessage)
+
+        if !ok || heartbeat.Uptime != 42 {
+            t.Errorf("DecodeDatagram() returned extensions %v", decoded.Extensions)
+        }
+    }
+}
+
+func Test_UnknownMessageType(t *testing.T) {
+    for _, payload := range []string{`{"Unknown":{"A":1}}`, `{"InReplyTo":1}`} {
+        var typeError *UnknownMessageTypeError
+
+        if _, err := decodeMessage([]byte(payload), false); !errors.As(err, &typeError) {
+            t.Errorf("Decoding %v returned %v instead of UnknownMessageTypeError", payload, err)
+        }
+    }
+
+    // Unknown types are skipped, if a known type is contained
+    message, err := decodeMessage([]byte(`{"Unknown":{},"DeviceAdvertisement":{"DeviceName":"pi"}}`), false)
+
+    if err != nil || message.DeviceAdvertisement == nil || message.DeviceAdvertisement.DeviceName != "pi" {
+        t.Errorf("Decoding known and unknown types returned %+v, %v", message, err)
+    }
+}
+
+func Test_RegisterMessageTypeConflict(t *testing.T) {
+    defer func() {
+        if recover() == nil {
+            t.Errorf("RegisterMessageType() accepted a built-in message type")
+        }
+    }()
+
+    RegisterMessageType("DeviceInformation", func() any { return &DeviceInformationMessage{} })
+}
@@ -0,0 +1,18 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+//go:build !unix
+
+package msg
+
+import "syscall"
+
+// Sharing the multicast port is not supported on this platform
+func reuseAddress(network, address string, conn syscall.RawConn) error {
+    return nil
+}
@@ -0,0 +1,32 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+//go:build unix
+
+package msg
+
+import "syscall"
+
+// Set SO_REUSEADDR before the socket is bound, so that multiple processes can
+// bind the same multicast port. On Linux this is enough for UDP. BSD systems
+// and macOS additionally need SO_REUSEPORT, because the sockets are bound to
+// the wildcard address and not to the multicast address, see reusePort().
+func reuseAddress(network, address string, conn syscall.RawConn) error {
+    var err error
+
+    controlErr := conn.Control(func(fd uintptr) {
+        err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+        if err == nil { err = reusePort(int(fd)) }
+    })
+
+    if controlErr != nil {
+        return controlErr
+    }
+
+    return err
+}
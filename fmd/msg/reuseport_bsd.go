@@ -0,0 +1,19 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package msg
+
+import "syscall"
+
+// Set SO_REUSEPORT, which BSD systems require to share a port bound to the
+// wildcard address
+func reusePort(fd int) error {
+    return syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEPORT, 1)
+}
@@ -0,0 +1,16 @@
+// fmd: Find My Device
+// © 2023 Dennis Schulmeister-Zimolong <dennis@wpvs.de>
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as
+// published by the Free Software Foundation, either version 3 of the
+// License, or (at your option) any later version.
+
+//go:build unix && !(darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package msg
+
+// SO_REUSEADDR is enough to share the port on this platform
+func reusePort(fd int) error {
+    return nil
+}
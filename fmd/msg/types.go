@@ -8,15 +8,31 @@
 
 package msg
 
-import "net"
+import (
+    "net"
+    "strings"
+)
 
 // Main message structure for passing around network messages in the program.
 // All commands of the program, that transmit or receive network datagrams
 // use this structure to construct or receive messages in a type-safe way.
+// Each pointer field is a message type. A single message can contain multiple
+// types, though usually only one is set.
 type Message struct {
+    // Protocol header, not part of the encoded payload. Filled in when the
+    // message is encoded or decoded.
+    Header Header `json:"-"`
+
+    // Message ID of the request, that is answered by this message
+    InReplyTo uint32
+
     ClientRequest       *ClientRequestMessage
     DeviceAdvertisement *DeviceAdvertisementMessage
     DeviceInformation   *DeviceInformationMessage
+    DeviceGoodbye       *DeviceGoodbyeMessage
+
+    // Message types registered with RegisterMessageType(), by type name
+    Extensions map[string]any `json:"-"`
 }
 
 // Generic request from client to device
@@ -25,6 +41,73 @@ type ClientRequestMessage struct {
     Parameters []string
 }
 
+// Request for DeviceInformation messages. Parameters are optional filters,
+// e.g. "group=lab" or "device=kitchen-pi", that can be given multiple times.
+const RequestDeviceInformation = "device-information"
+
+// Create new request for device information with optional group and device
+// name filters
+func NewDeviceInformationRequest(group string, deviceNames []string) Message {
+    request := &ClientRequestMessage{
+        Request:    RequestDeviceInformation,
+        Parameters: make([]string, 0),
+    }
+
+    if group != "" {
+        request.Parameters = append(request.Parameters, "group=" + group)
+    }
+
+    for _, deviceName := range deviceNames {
+        request.Parameters = append(request.Parameters, "device=" + deviceName)
+    }
+
+    return Message{ClientRequest: request}
+}
+
+// Get all values of a "name=value" parameter
+func (this *ClientRequestMessage) Parameter(name string) []string {
+    values := make([]string, 0)
+
+    for _, parameter := range this.Parameters {
+        key, value, found := strings.Cut(parameter, "=")
+
+        if found && key == name {
+            values = append(values, value)
+        }
+    }
+
+    return values
+}
+
+// Check whether a device matches the group and device name filters of the
+// request. Device names are compared with the device and host name.
+func (this *ClientRequestMessage) Matches(group, deviceName, hostName string) bool {
+    groups := this.Parameter("group")
+
+    if len(groups) > 0 && !containsFold(groups, group) {
+        return false
+    }
+
+    devices := this.Parameter("device")
+
+    if len(devices) > 0 && !containsFold(devices, deviceName) && !containsFold(devices, hostName) {
+        return false
+    }
+
+    return true
+}
+
+// Case-insensitive search for a string in a list
+func containsFold(list []string, value string) bool {
+    for _, entry := range list {
+        if strings.EqualFold(entry, value) {
+            return true
+        }
+    }
+
+    return false
+}
+
 // Local device advertisement multicast
 type DeviceAdvertisementMessage struct {
     Group      string
@@ -32,13 +115,45 @@ type DeviceAdvertisementMessage struct {
     HostName   string
 }
 
-// Detailed device information
+// Local device goodbye multicast, sent when a device stops advertising or
+// advertises under a new name. Receivers can consider the device offline
+// immediately.
+type DeviceGoodbyeMessage struct {
+    Group      string
+    DeviceName string
+    HostName   string
+}
+
+// Detailed device information. The optional fields can be suppressed by
+// the advertising device and are empty when not available on its platform.
 type DeviceInformationMessage struct {
     Group             string
     DeviceName        string
     HostName          string
     OperatingSystem   string
     NetworkInterfaces []NetworkInterface
+
+    // Kernel version, e.g. "6.1.0-13-amd64"
+    KernelVersion     string `json:",omitempty"`
+
+    // Pretty name of the OS release, e.g. "Debian GNU/Linux 12 (bookworm)"
+    OSRelease         string `json:",omitempty"`
+
+    // Hardware, e.g. "Raspberry Pi 4 Model B Rev 1.4", CPU and memory in bytes
+    HardwareModel     string `json:",omitempty"`
+    Architecture      string `json:",omitempty"`
+    CPUModel          string `json:",omitempty"`
+    CPUCount          int    `json:",omitempty"`
+    MemoryTotal       uint64 `json:",omitempty"`
+
+    // Seconds since the system has been booted
+    Uptime            uint64 `json:",omitempty"`
+
+    // Unique machine ID, e.g. from /etc/machine-id
+    MachineID         string `json:",omitempty"`
+
+    // Version of fmd on the device
+    Version           string `json:",omitempty"`
 }
 
 type NetworkInterface struct {
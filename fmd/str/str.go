@@ -10,12 +10,14 @@ package str
 
 import (
     "strings"
+    "unicode"
     "github.com/lithammer/dedent"
 )
 
 // Takes a CamelCasedString and splits it into individual words.
 // Words can also be separated with underlines, e.g. "registry_port" or "Device_Id".
 // Special care is taken for acronyms (words in all upper case) like "UDP_Port".
+// Digits belong to the preceding word, e.g. "MulticastIP4" or "Port2".
 func SplitCamelCaseString(original string) (words []string) {
     acronym := 0
     uppers  := []rune(strings.ToUpper(original))
@@ -38,6 +40,8 @@ func SplitCamelCaseString(original string) (words []string) {
             }
 
             acronym += 1
+        } else if unicode.IsDigit(runeOriginal) {
+            // Keep digits with the current word
         } else if runeOriginal == runeLower {
             if acronym > 1 {
                 result = append(result, builder.String())
@@ -22,6 +22,8 @@ func Test_SplitCamelCaseString(t *testing.T) {
     tests["HelloWORLDagain"]   = []string{"Hello", "WORLD", "again"}
     tests["HelloWORLD_Again"]  = []string{"Hello", "WORLD", "Again"}
     tests["HELLO_World"]       = []string{"HELLO", "World"}
+    tests["MulticastIP4"]      = []string{"Multicast", "IP4"}
+    tests["Port2Port"]         = []string{"Port2", "Port"}
 
     for str, expectedWords := range tests {
         actualWords := SplitCamelCaseString(str)
@@ -60,3 +62,20 @@ func Test_FixMultiLineString(t *testing.T) {
         t.Fail()
     }
 }
+
+func Test_Table(t *testing.T) {
+    table := NewTable("Flag", "Help")
+    table.Indent = "  "
+    table.AddRow("--port", "UDP port")
+    table.AddRow("--interval", "Seconds")
+
+    expected := "" +
+        "  Flag         Help\n" +
+        "  ----------   --------\n" +
+        "  --port       UDP port\n" +
+        "  --interval   Seconds\n"
+
+    if actual := table.String(); actual != expected {
+        t.Errorf("Table rendered as\n%v\ninstead of\n%v", actual, expected)
+    }
+}
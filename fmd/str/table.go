@@ -8,14 +8,99 @@
 
 package str
 
-//~ type Table struct {}
+import (
+    "strings"
+    "unicode/utf8"
+)
 
-//~ type TableInterface interface {
-    //~ [T any] Print(data T)
+// Simple text table with left-aligned columns for console output.
+// The header is optional and will be underlined, if given.
+type Table struct {
+    // Indentation of each line
+    Indent string
 
-    //~ [T any] PrintTo(data T, to Writer)
+    // Separator between two columns
+    Separator string
 
-    //~ [T any] RenderString(data T) string
-//~ }
+    header []string
+    rows   [][]string
+}
 
-//~ func NewTable() *Table {}
+// Create new table with the given column headers. Without headers, the
+// table will only contain the rows.
+func NewTable(header ...string) *Table {
+    return &Table{
+        Indent:    "",
+        Separator: "   ",
+        header:    header,
+        rows:      make([][]string, 0),
+    }
+}
+
+// Add a row to the table
+func (this *Table) AddRow(cells ...string) {
+    this.rows = append(this.rows, cells)
+}
+
+// Render the table into a string with one line per row
+func (this *Table) String() string {
+    widths := make([]int, 0)
+
+    measure := func(cells []string) {
+        for i, cell := range cells {
+            if i >= len(widths) {
+                widths = append(widths, 0)
+            }
+
+            if width := utf8.RuneCountInString(cell); width > widths[i] {
+                widths[i] = width
+            }
+        }
+    }
+
+    measure(this.header)
+
+    for _, row := range this.rows {
+        measure(row)
+    }
+
+    builder := strings.Builder{}
+
+    render := func(cells []string) {
+        line := strings.Builder{}
+        line.WriteString(this.Indent)
+
+        for i, cell := range cells {
+            if i > 0 {
+                line.WriteString(this.Separator)
+            }
+
+            line.WriteString(cell)
+
+            if i < len(cells) - 1 {
+                line.WriteString(strings.Repeat(" ", widths[i] - utf8.RuneCountInString(cell)))
+            }
+        }
+
+        builder.WriteString(strings.TrimRight(line.String(), " "))
+        builder.WriteString("\n")
+    }
+
+    if len(this.header) > 0 {
+        render(this.header)
+
+        underline := make([]string, len(this.header))
+
+        for i := range this.header {
+            underline[i] = strings.Repeat("-", widths[i])
+        }
+
+        render(underline)
+    }
+
+    for _, row := range this.rows {
+        render(row)
+    }
+
+    return builder.String()
+}
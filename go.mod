@@ -3,7 +3,15 @@ module github.com/DennisSchulmeister/find-my-device
 go 1.19
 
 require (
+	github.com/fxamacker/cbor/v2 v2.7.0
 	github.com/lithammer/dedent v1.1.0
 	golang.org/x/exp v0.0.0-20230116083435-1de6713980de
+	golang.org/x/net v0.12.0
 	golang.org/x/sync v0.1.0
+	golang.org/x/term v0.10.0
+)
+
+require (
+	github.com/x448/float16 v0.8.4 // indirect
+	golang.org/x/sys v0.10.0 // indirect
 )